@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// clapPostHandler adds the claps of the user to a post. Several claps can be sent at once
+// with the count query parameter, up to the per user limit.
+func (app *application) clapPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	maxClaps := app.cfg.claps.maxPerUser
+	count := app.readInt(r.URL.Query(), "count", 1, v)
+
+	v.Check(count >= 1, "count", "must be greater than zero")
+	v.Check(count <= maxClaps, "count", fmt.Sprintf("must not be more than %d", maxClaps))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userClaps, total, err := app.models.Claps.Add(id, user.ID, count, maxClaps)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		case errors.Is(err, data.ErrClapLimitReached):
+			app.resourceConflictResponse(w, r, fmt.Sprintf("you can't clap a post more than %d times", maxClaps))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"claps": total, "viewer_claps": userClaps}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unclapPostHandler takes back all the claps of the user on a post
+func (app *application) unclapPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Claps.Remove(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "claps successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// canEditPost reports whether the user is the author of the post or one of its accepted co-authors
+func (app *application) canEditPost(post *data.Post, user *data.User) (bool, error) {
+	if post.UserID == user.ID {
+		return true, nil
+	}
+
+	collaborator, err := app.models.Collaborators.Get(post.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return collaborator.CanEdit(), nil
+}
+
+// canReadPost reports whether the user can read the post. Unpublished posts are only readable by their
+// author, their accepted co-authors and reviewers, and the users who review or publish posts.
+func (app *application) canReadPost(post *data.Post, user *data.User) (bool, error) {
+	if post.Status == data.StatusPublished || post.UserID == user.ID {
+		return true, nil
+	}
+
+	collaborator, err := app.models.Collaborators.Get(post.ID, user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if collaborator != nil && collaborator.Accepted {
+		return true, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(data.PermissionPostsReview) || permissions.Include(data.PermissionPostsPublish), nil
+}
+
+func (app *application) inviteCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// only the author can invite collaborators
+	user := app.contextGetUser(r)
+	if post.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Username != "", "username", "must be provided")
+	v.Check(input.Username != user.Username, "username", "must not be the author of the post")
+
+	collaborator := &data.Collaborator{
+		PostID:    post.ID,
+		Role:      input.Role,
+		InvitedBy: user.ID,
+	}
+
+	if data.ValidateCollaborator(v, collaborator); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitee, err := app.models.Users.GetByUsername(input.Username)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("username", "no user with this username exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	collaborator.UserID = invitee.ID
+	collaborator.Username = invitee.Username
+
+	err = app.models.Collaborators.Insert(collaborator)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCollaborator):
+			app.resourceConflictResponse(w, r, "this user has already been invited to the post")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"username": invitee.Username,
+			"inviter":  user.Username,
+			"role":     collaborator.Role,
+			"postID":   post.ID,
+			"title":    post.Title,
+		}
+
+		err := app.mailer.Send(invitee.Email, "collaborator_invite.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"collaborator": collaborator}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	collaborators, err := app.models.Collaborators.GetAllForPost(post.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the list is only visible to the author and the people who were invited
+	user := app.contextGetUser(r)
+
+	allowed := post.UserID == user.ID
+	for _, c := range collaborators {
+		if c.UserID == user.ID {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptCollaborationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	collaborator, err := app.models.Collaborators.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if collaborator.Accepted {
+		app.resourceConflictResponse(w, r, "invitation is already accepted")
+		return
+	}
+
+	err = app.models.Collaborators.Accept(collaborator)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collaborator": collaborator}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the author can remove anyone, a collaborator can only remove themselves
+	user := app.contextGetUser(r)
+	if post.UserID != user.ID && userID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Collaborators.Delete(post.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "collaborator successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,12 +2,11 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/Infamous003/go-blog/internal/data"
 	"github.com/Infamous003/go-blog/internal/validator"
-	"github.com/go-chi/chi/v5"
 )
 
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +18,7 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	_, err = app.models.Posts.Get(postID)
+	post, err := app.models.Posts.Get(postID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -30,8 +29,20 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// a post hidden by a moderator takes no comments, and one held for review is only seen by its author
+	if post.Hidden || (post.Held && post.UserID != user.ID) {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	if post.CommentsMode != data.CommentsOpen {
+		app.resourceConflictResponse(w, r, "comments are "+post.CommentsMode+" on this post")
+		return
+	}
+
 	var input struct {
-		Body string `json:"body"`
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -41,9 +52,10 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	comment := data.Comment{
-		Body:   input.Body,
-		UserID: user.ID,
-		PostID: postID,
+		Body:     input.Body,
+		UserID:   user.ID,
+		PostID:   postID,
+		ParentID: input.ParentID,
 	}
 
 	v := validator.New()
@@ -53,7 +65,46 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.models.Comments.Insert(&comment)
+	if comment.ParentID != nil {
+		parent, err := app.models.Comments.Get(*comment.ParentID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// a deleted comment is only kept for the replies it already has
+		switch {
+		case parent == nil || parent.PostID != postID || parent.Deleted || (parent.Held && parent.UserID != user.ID):
+			v.AddError("parent_id", "must be a comment of this post")
+		case parent.Depth+1 > app.cfg.comments.maxDepth:
+			v.AddError("parent_id", fmt.Sprintf("must not be nested more than %d replies deep", app.cfg.comments.maxDepth))
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	verdict, err := app.checkSpam(r.Context(), data.HoldTargetComment, comment.Body, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Comments.Insert(&comment, spamHold(data.HoldTargetComment, comment.Body, user, verdict))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.recordFingerprint(comment.Body, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	comment.Mentions, err = app.syncMentions(data.MentionTargetComment, comment.ID, comment.Body, comment.Held, user, post)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -81,6 +132,10 @@ func (app *application) listCommentsForPostHandler(w http.ResponseWriter, r *htt
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 2, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = data.CommentSortSafelist
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
 
 	data.ValidateFilters(v, input.Filters)
 
@@ -89,13 +144,51 @@ func (app *application) listCommentsForPostHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	_, err = app.models.Posts.Get(postID)
+	post, err := app.models.Posts.Get(postID)
 	if err != nil {
 		app.notfoundResponse(w, r)
 		return
 	}
 
-	comments, metadata, err := app.models.Comments.GetForPost(postID, &input.Filters)
+	user := app.contextGetUser(r)
+
+	if (post.Hidden || post.Held) && post.UserID != user.ID {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	if post.CommentsMode == data.CommentsDisabled && post.UserID != user.ID {
+		err = app.writeJSON(w, http.StatusOK, envelope{"metadata": data.Metadata{}, "comments": []*data.Comment{}}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	comments, metadata, err := app.models.Comments.GetForPost(postID, user.ID, &input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrInvalidSort):
+			app.failedValidationResponse(w, r, map[string]string{"sort": "invalid sort value"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	flat := data.FlattenComments(comments)
+
+	err = app.loadCommentMentions(flat...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data.RedactHidden(flat, user.ID, post.UserID)
+
+	err = app.loadCommentReactions(user.ID, flat...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -107,22 +200,85 @@ func (app *application) listCommentsForPostHandler(w http.ResponseWriter, r *htt
 	}
 }
 
-func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
-	commentID, err := strconv.ParseInt(chi.URLParam(r, "comment_id"), 10, 0)
-	if err != nil || commentID < 1 {
+// getPostComment fetches the post and the comment in the URL, responding with not found when the
+// comment isn't on the post or was deleted
+func (app *application) getPostComment(w http.ResponseWriter, r *http.Request) (*data.Post, *data.Comment, bool) {
+	postID, err := app.readIDParam(r)
+	if err != nil {
 		app.notfoundResponse(w, r)
-		return
+		return nil, nil, false
 	}
 
-	user := app.contextGetUser(r)
+	commentID, err := app.readNamedIDParam(r, "comment_id")
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return nil, nil, false
+	}
 
-	postID, err := app.readIDParam(r)
+	post, err := app.models.Posts.Get(postID)
 	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	comment, err := app.models.Comments.Get(commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	if comment.PostID != post.ID || comment.Deleted {
 		app.notfoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	return post, comment, true
+}
+
+// deleteCommentHandler deletes a comment, either by its author or by the author of the post, who can
+// give a reason in the query string. The latter is logged as a moderation action.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	post, comment, ok := app.getPostComment(w, r)
+	if !ok {
 		return
 	}
 
-	err = app.models.Comments.Delete(commentID, user.ID, postID)
+	var moderation *data.ModerationAction
+
+	if comment.UserID != user.ID {
+		if post.UserID != user.ID {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		moderation = &data.ModerationAction{
+			ModeratorID: user.ID,
+			PostID:      &post.ID,
+			CommentID:   &comment.ID,
+			Action:      data.ActionDeleteComment,
+			Reason:      app.readString(r.URL.Query(), "reason", ""),
+		}
+
+		v := validator.New()
+		if data.ValidateModerationReason(v, moderation.Reason); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err := app.models.Comments.Delete(comment.ID, post.ID, moderation)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -144,41 +300,36 @@ func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Requ
 		Body string `json:"body"`
 	}
 
-	if err := app.readJSON(w, r, &input); err != nil {
+	err := app.readJSON(w, r, &input)
+	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	commentID, err := strconv.ParseInt(chi.URLParam(r, "comment_id"), 10, 0)
-	if err != nil || commentID < 1 {
-		app.notfoundResponse(w, r)
+	user := app.contextGetUser(r)
+
+	post, comment, ok := app.getPostComment(w, r)
+	if !ok {
 		return
 	}
 
-	user := app.contextGetUser(r)
-
-	postID, err := app.readIDParam(r)
-	if err != nil {
+	if comment.UserID != user.ID {
 		app.notfoundResponse(w, r)
 		return
 	}
 
-	comment, err := app.models.Comments.Get(commentID)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notfoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+	// the moderator reviews the comment as it was held, so it can't change until it's reviewed
+	if comment.Held {
+		app.resourceConflictResponse(w, r, "comment is held for review by a moderator and can't be edited")
 		return
 	}
 
-	if comment.UserID != user.ID || comment.PostID != postID {
-		app.notfoundResponse(w, r)
+	if post.CommentsMode != data.CommentsOpen {
+		app.resourceConflictResponse(w, r, "comments are "+post.CommentsMode+" on this post")
 		return
 	}
 
+	bodyChanged := input.Body != comment.Body
 	comment.Body = input.Body
 
 	v := validator.New()
@@ -187,7 +338,19 @@ func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.models.Comments.Update(comment)
+	// an edit goes through the spam checks like a new comment, or spam could be edited into a harmless one
+	var hold *data.SpamHold
+
+	if bodyChanged {
+		verdict, err := app.checkSpam(r.Context(), data.HoldTargetComment, comment.Body, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		hold = spamHold(data.HoldTargetComment, comment.Body, user, verdict)
+	}
+
+	err = app.models.Comments.Update(comment, hold)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -198,6 +361,20 @@ func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if bodyChanged {
+		err = app.recordFingerprint(comment.Body, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	comment.Mentions, err = app.syncMentions(data.MentionTargetComment, comment.ID, comment.Body, comment.Held, user, post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
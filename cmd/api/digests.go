@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// unsubscribe tokens outlive a couple of digests, so that the link in an older email still works
+const unsubscribeTokenTTL = 30 * 24 * time.Hour
+
+// startDigestJob periodically sends the users who follow tags a digest of the top new posts in them.
+// Users are checked every check interval, and each of them gets at most one digest per interval.
+func (app *application) startDigestJob() {
+	if !app.cfg.digest.enabled {
+		return
+	}
+
+	app.background(func() {
+		ticker := time.NewTicker(app.cfg.digest.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			app.sendDigests()
+
+			select {
+			case <-ticker.C:
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+func (app *application) sendDigests() {
+	// every digest comes with a new unsubscribe token, which are only deleted on unsubscribe otherwise
+	purged, err := app.models.Tokens.DeleteExpired(data.ScopeUnsubscribe)
+	if err != nil {
+		app.logger.Error("failed to delete expired unsubscribe tokens", "error", err.Error())
+	} else if purged > 0 {
+		app.logger.Info("deleted expired unsubscribe tokens", "count", purged)
+	}
+
+	recipients, err := app.models.Digests.GetDue(app.cfg.digest.interval)
+	if err != nil {
+		app.logger.Error("failed to fetch digest recipients", "error", err.Error())
+		return
+	}
+
+	sent := 0
+
+	for _, recipient := range recipients {
+		// not holding up the shutdown for a long list of emails, the rest go out after the restart
+		select {
+		case <-app.shutdown:
+			return
+		default:
+		}
+
+		ok, err := app.sendDigest(recipient)
+		if err != nil {
+			app.logger.Error("failed to send digest", "user_id", recipient.UserID, "error", err.Error())
+			continue
+		}
+
+		if ok {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		app.logger.Info("sent digests", "count", sent)
+	}
+}
+
+// sendDigest sends a digest to the recipient, ok is false if there were no new posts to send
+func (app *application) sendDigest(recipient *data.DigestRecipient) (ok bool, err error) {
+	now := time.Now()
+
+	posts, err := app.models.Digests.GetPosts(recipient.UserID, recipient.Since, app.cfg.digest.maxPosts)
+	if err != nil {
+		return false, err
+	}
+
+	// with nothing new the user is skipped until the next interval, instead of being checked again every time
+	if len(posts) == 0 {
+		return false, app.models.Digests.MarkSent(recipient.UserID, now)
+	}
+
+	token, err := app.models.Tokens.New(recipient.UserID, unsubscribeTokenTTL, data.ScopeUnsubscribe)
+	if err != nil {
+		return false, err
+	}
+
+	data := map[string]any{
+		"username":         recipient.Username,
+		"posts":            posts,
+		"unsubscribeToken": token.Plaintext,
+	}
+
+	err = app.mailer.Send(recipient.Email, "tag_digest.tmpl", data)
+	if err != nil {
+		return false, err
+	}
+
+	return true, app.models.Digests.MarkSent(recipient.UserID, now)
+}
+
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	tag, ok := app.getTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tags.Follow(user.ID, tag.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully followed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	tag, ok := app.getTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tags.Unfollow(user.ID, tag.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully unfollowed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listFollowedTagsHandler returns the tags the user follows, and whether they get the digest emails
+func (app *application) listFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	tags, err := app.models.Tags.GetFollowed(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	subscribed, err := app.models.Digests.IsSubscribed(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags, "digest_subscribed": subscribed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateDigestHandler turns the digest emails of the logged in user on or off
+func (app *application) updateDigestHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Subscribed *bool `json:"subscribed"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Subscribed != nil, "subscribed", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Digests.SetSubscribed(user.ID, *input.Subscribed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"digest_subscribed": *input.Subscribed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribeDigestHandler turns the digest emails off with the token from a digest email,
+// which works without logging in
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeUnsubscribe, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unsubscribe token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Digests.SetSubscribed(user.ID, false)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeUnsubscribe, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully unsubscribed from the digest emails"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
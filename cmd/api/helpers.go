@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Infamous003/go-blog/internal/validator"
 	"github.com/go-chi/chi/v5"
@@ -17,9 +18,14 @@ import (
 type envelope map[string]any
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
-	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 0)
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads a positive integer id from the URL parameter with the given name, e.g. post_id
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 0)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -128,3 +134,38 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+// readDate reads a date in the YYYY-MM-DD format, returning nil when it's missing
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date in the YYYY-MM-DD format")
+		return nil
+	}
+
+	return &t
+}
+
+// background runs fn in a separate goroutine which is tracked by app.wg, so that the
+// server waits for it to finish before shutting down. Panics are recovered and logged.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
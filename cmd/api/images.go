@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/images"
+	"github.com/Infamous003/go-blog/internal/storage"
+)
+
+// errUnprocessableImage wraps the errors which processing the image again won't fix, like a file
+// which can't be decoded
+var errUnprocessableImage = errors.New("unprocessable image")
+
+// Processing an image is attempted imageAttempts times, waiting imageRetryDelay before the first
+// retry and twice as long before each of the next ones
+const (
+	imageAttempts   = 4
+	imageRetryDelay = 5 * time.Second
+)
+
+// startImageWorkers starts the workers of the image pipeline, which generate the variants of
+// uploaded images in the background. Images left pending by a previous run are queued again.
+func (app *application) startImageWorkers() {
+	for range app.cfg.images.workers {
+		app.background(app.imageWorker)
+	}
+
+	app.background(func() {
+		ids, err := app.models.Media.GetPendingIDs()
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+
+		for _, id := range ids {
+			select {
+			case app.imageQueue <- id:
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+func (app *application) imageWorker() {
+	for {
+		select {
+		case id := <-app.imageQueue:
+			if !app.processImageWithRetries(id) {
+				return
+			}
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// processImageWithRetries processes an image, retrying the errors which are most likely temporary,
+// like a storage or database hiccup. The media is only marked as failed when the image itself can't
+// be processed, one which still fails after the retries stays pending until the next start. It
+// returns false when the server shut down while waiting for a retry.
+func (app *application) processImageWithRetries(id int64) bool {
+	delay := imageRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := app.processImage(id)
+
+		switch {
+		case err == nil, errors.Is(err, data.ErrRecordNotFound):
+			// processed, or deleted in the meantime
+			return true
+
+		case errors.Is(err, errUnprocessableImage):
+			app.logger.Error("failed to process image", "media_id", id, "error", err.Error())
+
+			err = app.models.Media.SetStatus(id, data.MediaFailed)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+			return true
+
+		case attempt == imageAttempts:
+			app.logger.Error("failed to process image, leaving it pending", "media_id", id, "attempts", attempt, "error", err.Error())
+			return true
+		}
+
+		app.logger.Warn("failed to process image, retrying", "media_id", id, "attempt", attempt, "error", err.Error())
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-app.shutdown:
+			return false
+		}
+	}
+}
+
+// enqueueImage queues an uploaded image for processing. If the queue is full the image
+// stays pending, and is picked up again when the server restarts.
+func (app *application) enqueueImage(id int64) {
+	select {
+	case app.imageQueue <- id:
+	default:
+		app.logger.Warn("image queue is full, leaving the image pending", "media_id", id)
+	}
+}
+
+// processImage re-encodes the private original image to strip its metadata, records its
+// dimensions, and generates its thumbnail and width based variants, which are all public
+func (app *application) processImage(id int64) (err error) {
+	// a malformed image shouldn't take a worker down with it
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errUnprocessableImage, r)
+		}
+	}()
+
+	media, err := app.models.Media.Get(id)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rc, err := app.storage.Get(ctx, media.Key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			return fmt.Errorf("%w: %w", errUnprocessableImage, err)
+		default:
+			return err
+		}
+	}
+
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	img, format, err := images.Decode(content)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnprocessableImage, err)
+	}
+
+	media.Width = img.Bounds().Dx()
+	media.Height = img.Bounds().Dy()
+
+	outputType := images.OutputType(format)
+	ext := data.ImageContentTypes[outputType]
+	base := strings.TrimSuffix(strings.TrimPrefix(media.Key, privateMediaPrefix), path.Ext(media.Key))
+
+	// keys of the objects written so far, deleted again if something fails along the way
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, key := range written {
+				if err := app.storage.Delete(context.Background(), key); err != nil {
+					app.logger.Error(err.Error())
+				}
+			}
+		}
+	}()
+
+	put := func(key string, buf *bytes.Buffer, contentType string) error {
+		err := app.storage.Put(ctx, key, buf, int64(buf.Len()), contentType)
+		if err == nil {
+			written = append(written, key)
+		}
+		return err
+	}
+
+	// Re-encoding the original drops its metadata, EXIF and its GPS location included. GIFs are
+	// re-encoded frame by frame, keeping their animation but not their XMP data. Either way the result
+	// is stored under a public key, and the private original stays intact until the database points to it.
+	oldKey := media.Key
+
+	buf := new(bytes.Buffer)
+
+	switch format {
+	case "gif":
+		err = images.ReencodeGIF(buf, content)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errUnprocessableImage, err)
+		}
+		media.Key = base + "_original" + path.Ext(oldKey)
+	default:
+		err = images.Encode(buf, img, outputType)
+		if err != nil {
+			return err
+		}
+
+		media.Key = base + "_original" + ext
+		media.ContentType = outputType
+	}
+
+	media.Size = int64(buf.Len())
+
+	err = put(media.Key, buf, media.ContentType)
+	if err != nil {
+		return err
+	}
+
+	var variants []*data.MediaVariant
+
+	for _, spec := range images.Specs {
+		if !spec.Square && spec.Width >= media.Width {
+			continue
+		}
+
+		var resized image.Image
+
+		switch {
+		case spec.Square:
+			resized = images.Thumbnail(img, spec.Width)
+		default:
+			resized = images.Resize(img, spec.Width)
+		}
+
+		buf := new(bytes.Buffer)
+
+		err = images.Encode(buf, resized, outputType)
+		if err != nil {
+			return err
+		}
+
+		v := &data.MediaVariant{
+			Name:        spec.Name,
+			Key:         base + "_" + spec.Name + ext,
+			ContentType: outputType,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			Size:        int64(buf.Len()),
+		}
+
+		err = put(v.Key, buf, outputType)
+		if err != nil {
+			return err
+		}
+
+		variants = append(variants, v)
+	}
+
+	err = app.models.Media.SetProcessed(media, variants)
+	if err != nil {
+		return err
+	}
+
+	// the private original, which may still contain the EXIF data, is no longer referenced
+	if err := app.storage.Delete(ctx, oldKey); err != nil {
+		app.logger.Error(err.Error())
+	}
+
+	return nil
+}
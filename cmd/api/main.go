@@ -2,33 +2,45 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Infamous003/go-blog/internal/data"
 	"github.com/Infamous003/go-blog/internal/mailer"
+	"github.com/Infamous003/go-blog/internal/spam"
+	"github.com/Infamous003/go-blog/internal/storage"
 	_ "github.com/lib/pq"
 )
 
 var version = "1.0.0"
 
 type application struct {
-	cfg    config
-	logger *slog.Logger
-	models data.Models
-	mailer *mailer.Mailer
-	wg     sync.WaitGroup
+	cfg     config
+	logger  *slog.Logger
+	models  data.Models
+	mailer  *mailer.Mailer
+	storage storage.Storage
+	spam    *spam.Pipeline
+	wg      sync.WaitGroup
+
+	imageQueue chan int64    // ids of uploaded images waiting for the image pipeline
+	views      *viewBuffer   // post views waiting to be written to the database
+	related    *relatedCache // related posts of recently viewed posts
+	shutdown   chan struct{} // closed when the server shuts down, stops the background workers
 }
 
 type config struct {
-	port int
-	env  string
+	port         int
+	env          string
+	cursorSecret string
 
 	db struct {
 		dsn          string
@@ -43,6 +55,91 @@ type config struct {
 		enabled bool
 	}
 
+	review struct {
+		enabled bool
+	}
+
+	claps struct {
+		maxPerUser int
+	}
+
+	comments struct {
+		maxDepth int
+	}
+
+	spam struct {
+		enabled                bool
+		threshold              float64
+		maxLinks               int
+		newAccountAge          time.Duration
+		duplicateWindow        time.Duration
+		duplicateMaxCopies     int
+		blockedWords           []string
+		blockedDomains         []string
+		classifierMinDocuments int
+	}
+
+	reactions struct {
+		emoji []string
+	}
+
+	views struct {
+		secret        string
+		window        time.Duration
+		flushInterval time.Duration
+		batchSize     int
+	}
+
+	trending struct {
+		interval time.Duration
+		halfLife time.Duration
+	}
+
+	related struct {
+		cacheTTL  time.Duration
+		cacheSize int
+	}
+
+	search struct {
+		highlightStart   string
+		highlightStop    string
+		snippetWords     int
+		snippetFragments int
+		suggestTimeout   time.Duration
+	}
+
+	digest struct {
+		enabled       bool
+		interval      time.Duration
+		checkInterval time.Duration
+		maxPosts      int
+	}
+
+	media struct {
+		maxSize int64
+	}
+
+	images struct {
+		workers   int
+		queueSize int
+	}
+
+	storage struct {
+		backend  string
+		localDir string
+		baseURL  string
+
+		s3 struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+			useSSL    bool
+			publicURL string
+		}
+	}
+
 	smtp struct {
 		host     string
 		port     int
@@ -59,6 +156,7 @@ func main() {
 	// Server configurations
 	flag.IntVar(&cfg.port, "port", 9090, "server port")
 	flag.StringVar(&cfg.env, "env", "dev", "Environment (dev | prod | test)")
+	flag.StringVar(&cfg.cursorSecret, "cursor-secret", os.Getenv("CURSOR_SECRET"), "Secret the pagination cursors are signed with (random when empty)")
 
 	// DB configurations
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("GOBLOG_DSN"), "PostgreSQL DSN")
@@ -71,6 +169,86 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enavle rate limiter")
 
+	// Editorial review configurations
+	flag.BoolVar(&cfg.review.enabled, "review-enabled", false, "Require posts to be reviewed and approved before an editor publishes them")
+
+	// Clap configurations
+	flag.IntVar(&cfg.claps.maxPerUser, "claps-max-per-user", 50, "Maximum number of times a user can clap the same post")
+
+	// Comment configurations
+	flag.IntVar(&cfg.comments.maxDepth, "comments-max-depth", 5, "Maximum depth of comment replies, replies to top level comments being at depth 1")
+
+	// Spam configurations
+	flag.BoolVar(&cfg.spam.enabled, "spam-enabled", true, "Hold new posts and comments which look like spam for review")
+	flag.Float64Var(&cfg.spam.threshold, "spam-threshold", 1, "Spam score at which a post or comment is held for review")
+	flag.IntVar(&cfg.spam.maxLinks, "spam-max-links", 3, "Number of links a post or comment can have before it counts towards spam")
+	flag.DurationVar(&cfg.spam.newAccountAge, "spam-new-account-age", 24*time.Hour, "Age under which an account is new, and its posts and comments count towards spam")
+	flag.DurationVar(&cfg.spam.duplicateWindow, "spam-duplicate-window", 24*time.Hour, "Time within which the same text posted again counts as a copy")
+	flag.IntVar(&cfg.spam.duplicateMaxCopies, "spam-duplicate-max-copies", 3, "Number of copies of a text after which more of them are held for review")
+	flag.Func("spam-blocked-words", "Comma separated list of words which count towards spam", func(val string) error {
+		cfg.spam.blockedWords = splitLowerCSV(val)
+		return nil
+	})
+	flag.Func("spam-blocked-domains", "Comma separated list of domains, links to which count towards spam", func(val string) error {
+		cfg.spam.blockedDomains = splitLowerCSV(val)
+		return nil
+	})
+	flag.IntVar(&cfg.spam.classifierMinDocuments, "spam-classifier-min-documents", 20, "Number of spam and of approved documents the spam classifier has to learn from before it's used")
+
+	// Reaction configurations
+	cfg.reactions.emoji = []string{"👍", "❤️", "😂", "🎉", "😮", "😢"}
+	flag.Func("reactions-emoji", "Comma separated list of the emoji users can react with", func(val string) error {
+		cfg.reactions.emoji = nil
+		for emoji := range strings.SplitSeq(val, ",") {
+			if emoji = strings.TrimSpace(emoji); emoji != "" {
+				cfg.reactions.emoji = append(cfg.reactions.emoji, emoji)
+			}
+		}
+		return nil
+	})
+
+	// View counting configurations
+	flag.StringVar(&cfg.views.secret, "views-secret", os.Getenv("VIEWS_SECRET"), "Secret the readers of posts are hashed with (random when empty)")
+	flag.DurationVar(&cfg.views.window, "views-dedupe-window", 30*time.Minute, "Time within which repeated views of a post by the same reader are counted once")
+	flag.DurationVar(&cfg.views.flushInterval, "views-flush-interval", 10*time.Second, "How often buffered post views are written to the database")
+	flag.IntVar(&cfg.views.batchSize, "views-batch-size", 500, "Number of buffered post views which triggers an early write")
+
+	// Trending configurations
+	flag.DurationVar(&cfg.trending.interval, "trending-interval", 10*time.Minute, "How often the trending scores of posts are recomputed")
+	flag.DurationVar(&cfg.trending.halfLife, "trending-half-life", 24*time.Hour, "Time after which views, claps and comments count half as much towards trending")
+
+	// Related posts configurations
+	flag.DurationVar(&cfg.related.cacheTTL, "related-cache-ttl", time.Hour, "How long the related posts of a post are cached")
+	flag.IntVar(&cfg.related.cacheSize, "related-cache-size", 10000, "Maximum number of posts whose related posts are cached")
+
+	// Search configurations
+	flag.StringVar(&cfg.search.highlightStart, "search-highlight-start", "<mark>", "Marker inserted before matched words in search highlights")
+	flag.StringVar(&cfg.search.highlightStop, "search-highlight-stop", "</mark>", "Marker inserted after matched words in search highlights")
+	flag.IntVar(&cfg.search.snippetWords, "search-snippet-words", 30, "Maximum number of words in each fragment of a search snippet")
+	flag.IntVar(&cfg.search.snippetFragments, "search-snippet-fragments", 2, "Maximum number of fragments in a search snippet")
+	flag.DurationVar(&cfg.search.suggestTimeout, "search-suggest-timeout", 300*time.Millisecond, "Time budget of the search suggestions, after which the suggestions found so far are returned")
+
+	// Digest configurations
+	flag.BoolVar(&cfg.digest.enabled, "digest-enabled", true, "Send digest emails of new posts in followed tags")
+	flag.DurationVar(&cfg.digest.interval, "digest-interval", 7*24*time.Hour, "How often a user receives a digest email")
+	flag.DurationVar(&cfg.digest.checkInterval, "digest-check-interval", time.Hour, "How often users are checked for a due digest email")
+	flag.IntVar(&cfg.digest.maxPosts, "digest-max-posts", 10, "Maximum number of posts in a digest email")
+
+	// Media and storage configurations
+	flag.Int64Var(&cfg.media.maxSize, "media-max-size", 5*1024*1024, "Maximum size of an uploaded file in bytes")
+	flag.IntVar(&cfg.images.workers, "images-workers", 2, "Number of workers processing uploaded images")
+	flag.IntVar(&cfg.images.queueSize, "images-queue-size", 100, "Maximum number of uploaded images waiting to be processed")
+	flag.StringVar(&cfg.storage.backend, "storage", getEnv("STORAGE_BACKEND", "local"), "Storage backend for uploads (local | s3)")
+	flag.StringVar(&cfg.storage.localDir, "storage-local-dir", "./uploads", "Directory for uploads when using the local storage")
+	flag.StringVar(&cfg.storage.baseURL, "storage-base-url", os.Getenv("STORAGE_BASE_URL"), "Public URL of the local storage (defaults to http://localhost:{port}/uploads)")
+	flag.StringVar(&cfg.storage.s3.endpoint, "s3-endpoint", getEnv("S3_ENDPOINT", "localhost:9000"), "S3 endpoint, without the scheme")
+	flag.StringVar(&cfg.storage.s3.region, "s3-region", getEnv("S3_REGION", "us-east-1"), "S3 region")
+	flag.StringVar(&cfg.storage.s3.bucket, "s3-bucket", getEnv("S3_BUCKET", "goblog"), "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.accessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.storage.s3.secretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+	flag.BoolVar(&cfg.storage.s3.useSSL, "s3-use-ssl", false, "Use HTTPS to connect to S3")
+	flag.StringVar(&cfg.storage.s3.publicURL, "s3-public-url", os.Getenv("S3_PUBLIC_URL"), "Public URL of the S3 bucket (defaults to {endpoint}/{bucket})")
+
 	// SMTP configurations
 	flag.StringVar(&cfg.smtp.host, "smtp-host", getEnv("SMTP_HOST", "sandbox.smtp.mailtrap.io"), "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", getEnvInt("SMTP_PORT", 2525), "SMTP port")
@@ -101,15 +279,53 @@ func main() {
 		os.Exit(1)
 	}
 
+	store, err := OpenStorage(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("storage initialized", "backend", cfg.storage.backend)
+
 	SetBuildInfo(version, time.Now().String(), cfg.env)
 
+	// without a configured secret, the cursors handed out stop working when the server restarts
+	cursorSecret := []byte(cfg.cursorSecret)
+	if len(cursorSecret) == 0 {
+		logger.Warn("no cursor secret configured, using a random one")
+		cursorSecret = []byte(rand.Text())
+	}
+	data.SetCursorSecret(cursorSecret)
+
+	// without a configured secret, readers are counted as new readers after a restart
+	viewsSecret := []byte(cfg.views.secret)
+	if len(viewsSecret) == 0 {
+		logger.Warn("no views secret configured, using a random one")
+		viewsSecret = []byte(rand.Text())
+	}
+
+	models := data.NewModels(db)
+
 	app := application{
-		cfg:    cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer,
+		cfg:     cfg,
+		logger:  logger,
+		models:  models,
+		mailer:  mailer,
+		storage: store,
+		spam:    newSpamPipeline(cfg, models.Spam),
+
+		imageQueue: make(chan int64, cfg.images.queueSize),
+		views:      newViewBuffer(viewsSecret),
+		related:    newRelatedCache(cfg.related.cacheSize),
+		shutdown:   make(chan struct{}),
 	}
 
+	app.startImageWorkers()
+	app.startViewFlusher()
+	app.startTrendingJob()
+	app.startDigestJob()
+	app.startFingerprintExpiry()
+
 	if err = app.serve(); err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -139,6 +355,36 @@ func OpenDB(cfg config) (*sql.DB, error) {
 	return db, nil
 }
 
+// Returns the storage backend for uploaded files selected in the config
+func OpenStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "local":
+		baseURL := cfg.storage.baseURL
+		if baseURL == "" {
+			baseURL = fmt.Sprintf("http://localhost:%d/uploads", cfg.port)
+		}
+		return storage.NewLocal(cfg.storage.localDir, baseURL)
+	case "s3":
+		s3 := cfg.storage.s3
+		return storage.NewS3(s3.endpoint, s3.region, s3.bucket, s3.accessKey, s3.secretKey, s3.useSSL, s3.publicURL)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
+
+// splitLowerCSV splits a comma separated list, lowercasing the values and dropping the empty ones
+func splitLowerCSV(val string) []string {
+	values := []string{}
+
+	for value := range strings.SplitSeq(val, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
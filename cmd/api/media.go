@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/images"
+	"github.com/Infamous003/go-blog/internal/storage"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// privateMediaPrefix is the prefix of the keys of uploaded originals. They can still carry EXIF
+// data, like the GPS location, so they are never served: only the re-encoded original and the
+// variants generated from it are public.
+const privateMediaPrefix = "private/"
+
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	maxSize := app.cfg.media.maxSize
+
+	// allowing some room on top of the file for the multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+64*1024)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must be multipart/form-data"))
+		return
+	}
+
+	var (
+		content  []byte
+		filename string
+	)
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.Is(err, io.EOF):
+				app.badRequestResponse(w, r, errors.New("body must contain a file field"))
+			case errors.As(err, &maxBytesError):
+				app.payloadTooLargeResponse(w, r, maxSize)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		// reading one byte more than allowed tells us if the file is too large
+		content, err = io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesError):
+				app.payloadTooLargeResponse(w, r, maxSize)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		filename = filepath.Base(part.FileName())
+		break
+	}
+
+	if int64(len(content)) > maxSize {
+		app.payloadTooLargeResponse(w, r, maxSize)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(content) > 0, "file", "must not be empty")
+	v.Check(len(filename) <= 255, "file", "must have a file name shorter than 255 characters")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the Content-Type sent by the client can't be trusted, so it's sniffed from the content itself
+	contentType := http.DetectContentType(content)
+
+	ext, ok := data.ImageContentTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r, contentType)
+		return
+	}
+
+	// checking the declared dimensions up front, the image pipeline refuses to decode huge images
+	err = images.CheckDimensions(content)
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrTooLarge):
+			v.AddError("file", fmt.Sprintf("must not be larger than %dx%d pixels or %d megapixels", images.MaxWidth, images.MaxHeight, images.MaxPixels/1_000_000))
+		default:
+			v.AddError("file", "must be a valid image")
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	media := &data.Media{
+		UserID:      user.ID,
+		Key:         fmt.Sprintf("%s%d/%s%s", privateMediaPrefix, user.ID, strings.ToLower(rand.Text()), ext),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = app.storage.Put(ctx, media.Key, bytes.NewReader(content), media.Size, media.ContentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Media.Insert(media)
+	if err != nil {
+		// not leaving an orphaned file behind in the storage
+		if err := app.storage.Delete(ctx, media.Key); err != nil {
+			app.logger.Error(err.Error())
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.enqueueImage(media.ID)
+
+	app.setMediaURLs(media)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"media": media}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMediaHandler returns an upload of the logged in user, or the cover image of a published post.
+// Other uploads are not found, so that they can't be enumerated by their ids.
+func (app *application) showMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	media, err := app.models.Media.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if media.UserID != user.ID {
+		published, err := app.models.Media.IsPublishedCover(media.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !published {
+			app.notfoundResponse(w, r)
+			return
+		}
+	}
+
+	app.setMediaURLs(media)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"media": media}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	media, err := app.models.Media.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Media.Delete(media.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	keys := []string{media.Key}
+	for _, v := range media.Variants {
+		keys = append(keys, v.Key)
+	}
+
+	for _, key := range keys {
+		err = app.storage.Delete(ctx, key)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "media successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkCoverImage makes sure that the media to be used as the cover image of a post exists
+// and was uploaded by one of userIDs, otherwise an error is added to v
+func (app *application) checkCoverImage(v *validator.Validator, id int64, userIDs ...int64) error {
+	media, err := app.models.Media.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("cover_image_id", "must be an image uploaded by you")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	v.Check(slices.Contains(userIDs, media.UserID), "cover_image_id", "must be an image uploaded by you")
+
+	return nil
+}
+
+// loadCoverImages fetches the cover images of posts, along with their variants
+func (app *application) loadCoverImages(posts ...*data.Post) error {
+	var ids []int64
+	for _, post := range posts {
+		if post.CoverImageID != nil {
+			ids = append(ids, *post.CoverImageID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	media, err := app.models.Media.GetMany(ids)
+	if err != nil {
+		return err
+	}
+
+	app.setMediaURLs(media...)
+
+	byID := make(map[int64]*data.Media, len(media))
+	for _, m := range media {
+		byID[m.ID] = m
+	}
+
+	for _, post := range posts {
+		if post.CoverImageID != nil {
+			post.CoverImage = byID[*post.CoverImageID]
+		}
+	}
+
+	return nil
+}
+
+// setMediaURLs fills in the public URLs of media and their variants, and builds the srcset
+// out of the width based variants and the original. Media which isn't ready only has its
+// private original, so it gets no URL.
+func (app *application) setMediaURLs(media ...*data.Media) {
+	for _, m := range media {
+		if m.Status != data.MediaReady {
+			continue
+		}
+
+		m.URL = app.storage.URL(m.Key)
+
+		var srcset []string
+
+		for _, v := range m.Variants {
+			v.URL = app.storage.URL(v.Key)
+
+			if v.Name != "thumbnail" {
+				srcset = append(srcset, fmt.Sprintf("%s %dw", v.URL, v.Width))
+			}
+		}
+
+		srcset = append(srcset, fmt.Sprintf("%s %dw", m.URL, m.Width))
+		m.Srcset = strings.Join(srcset, ", ")
+	}
+}
+
+// serveUploads serves the files of the local storage. Directory listings are disabled,
+// so that the uploads of other users can't be enumerated, and the private originals
+// aren't served at all.
+func (app *application) serveUploads(local *storage.Local) http.Handler {
+	fs := http.StripPrefix("/uploads/", http.FileServer(http.Dir(local.Dir())))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(path.Clean(r.URL.Path), "/uploads/")
+
+		if strings.HasSuffix(r.URL.Path, "/") || strings.HasPrefix(key+"/", privateMediaPrefix) {
+			app.notfoundResponse(w, r)
+			return
+		}
+
+		fs.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/Infamous003/go-blog/internal/data"
+)
+
+// syncMentions stores the users mentioned in the text of a post or comment, and emails the ones who
+// were never notified of it. Nobody is notified of content held for review as spam until it's approved,
+// nor of a post, or a comment on a post, which isn't published yet.
+func (app *application) syncMentions(targetType string, targetID int64, text string, held bool, author *data.User, post *data.Post) ([]*data.Mention, error) {
+	mentions, err := app.models.Mentions.Sync(targetType, targetID, author.ID, data.ParseMentions(text))
+	if err != nil {
+		return nil, err
+	}
+
+	if held || post.Status != data.StatusPublished {
+		return mentions, nil
+	}
+
+	err = app.notifyMentions(targetType, targetID, author, post)
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// notifyMentions emails the users mentioned in a post or comment who weren't notified of it yet
+func (app *application) notifyMentions(targetType string, targetID int64, author *data.User, post *data.Post) error {
+	notices, err := app.models.Mentions.Notify(targetType, targetID)
+	if err != nil || len(notices) == 0 {
+		return err
+	}
+
+	app.background(func() {
+		for _, notice := range notices {
+			data := map[string]any{
+				"username":   notice.Username,
+				"author":     author.Username,
+				"authorID":   author.ID,
+				"targetType": targetType,
+				"postID":     post.ID,
+				"title":      post.Title,
+			}
+
+			err := app.mailer.Send(notice.Email, "mention.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		}
+	})
+
+	return nil
+}
+
+// notifyPublishedMentions emails the users mentioned in a post once it's published, in the name of its author
+func (app *application) notifyPublishedMentions(post *data.Post) error {
+	author, err := app.models.Users.Get(post.UserID)
+	if err != nil {
+		return err
+	}
+
+	return app.notifyMentions(data.MentionTargetPost, post.ID, author, post)
+}
+
+// notifyApprovedMentions emails the users mentioned in held content once a moderator approved it. A post
+// is still a draft at that point, its mentions are notified when it's published.
+func (app *application) notifyApprovedMentions(hold *data.SpamHold) error {
+	author, err := app.models.Users.Get(hold.AuthorID)
+	if err != nil {
+		return err
+	}
+
+	postID := hold.TargetID
+	if hold.TargetType == data.HoldTargetComment {
+		comment, err := app.models.Comments.Get(hold.TargetID)
+		if err != nil {
+			return err
+		}
+		postID = comment.PostID
+	}
+
+	post, err := app.models.Posts.Get(postID)
+	if err != nil {
+		return err
+	}
+
+	if post.Status != data.StatusPublished {
+		return nil
+	}
+
+	return app.notifyMentions(hold.TargetType, hold.TargetID, author, post)
+}
+
+// loadPostMentions fills in the users mentioned in posts
+func (app *application) loadPostMentions(posts ...*data.Post) error {
+	targets := make(map[int64]*[]*data.Mention, len(posts))
+	for _, post := range posts {
+		targets[post.ID] = &post.Mentions
+	}
+
+	return app.models.Mentions.Load(data.MentionTargetPost, targets)
+}
+
+// loadCommentMentions fills in the users mentioned in comments, other than the deleted ones
+func (app *application) loadCommentMentions(comments ...*data.Comment) error {
+	targets := make(map[int64]*[]*data.Mention, len(comments))
+	for _, comment := range comments {
+		if !comment.Deleted {
+			targets[comment.ID] = &comment.Mentions
+		}
+	}
+
+	return app.models.Mentions.Load(data.MentionTargetComment, targets)
+}
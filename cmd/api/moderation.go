@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// setCommentsModeHandler opens, locks or disables the comments of a post, by the author of the post
+func (app *application) setCommentsModeHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	post, ok := app.getModeratedPost(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Mode   string `json:"mode"`
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(input.Mode, data.CommentsOpen, data.CommentsLocked, data.CommentsDisabled), "mode", "must be one of open, locked or disabled")
+	data.ValidateModerationReason(v, input.Reason)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Mode == post.CommentsMode {
+		app.resourceConflictResponse(w, r, "comments are already "+post.CommentsMode+" on this post")
+		return
+	}
+
+	err = app.models.Posts.SetCommentsMode(post, input.Mode, user.ID, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments_mode": post.CommentsMode}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// hideCommentHandler hides or unhides a comment on a post, by the author of the post
+func (app *application) hideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	post, comment, ok := app.getPostComment(w, r)
+	if !ok {
+		return
+	}
+
+	if post.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Hidden *bool  `json:"hidden"`
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Hidden != nil, "hidden", "must be provided")
+	data.ValidateModerationReason(v, input.Reason)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.Hidden == comment.Hidden {
+		app.resourceConflictResponse(w, r, "the comment is already in that state")
+		return
+	}
+
+	moderation := &data.ModerationAction{
+		ModeratorID: user.ID,
+		PostID:      &post.ID,
+		CommentID:   &comment.ID,
+		Action:      data.ActionUnhideComment,
+		Reason:      input.Reason,
+	}
+	if *input.Hidden {
+		moderation.Action = data.ActionHideComment
+	}
+
+	err = app.models.Comments.SetHidden(comment, *input.Hidden, moderation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listModerationActionsHandler returns the moderation log of a post, to the author of the post
+func (app *application) listModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.getModeratedPost(w, r)
+	if !ok {
+		return
+	}
+
+	actions, err := app.models.Moderation.GetAllForPost(post.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"actions": actions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getModeratedPost fetches the post in the URL, responding with not permitted unless the user is its author
+func (app *application) getModeratedPost(w http.ResponseWriter, r *http.Request) (*data.Post, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return nil, false
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if post.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return post, true
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"slices"
 
 	"github.com/Infamous003/go-blog/internal/data"
 	"github.com/Infamous003/go-blog/internal/validator"
@@ -26,6 +27,66 @@ func (app *application) showPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	user := app.contextGetUser(r)
+
+	// a post hidden by a moderator or held for review is only readable by its author
+	if (post.Hidden || post.Held) && post.UserID != user.ID {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	canRead, err := app.canReadPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canRead {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	// authors reading their own posts don't count as readers
+	if post.Status == data.StatusPublished && post.UserID != user.ID {
+		app.recordView(r, post.ID)
+	}
+
+	post.Series, err = app.models.Series.GetForPost(post.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadCoverImages(post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	claps, err := app.models.Claps.GetForUser(post.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	post.ViewerClaps = &claps
+
+	err = app.loadBookmarks(user.ID, post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostReactions(user.ID, post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostMentions(post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"post": post}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -35,8 +96,7 @@ func (app *application) showPostHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) ListPostsHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string
-		Tags    []string
+		Query   data.PostQuery
 		Filters data.Filter
 	}
 
@@ -44,12 +104,24 @@ func (app *application) ListPostsHandler(w http.ResponseWriter, r *http.Request)
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Tags = app.readCSV(qs, "tags", []string{})
+	// title is the old name of q, it always searched all of the text and not just the titles
+	input.Query.Search = app.readString(qs, "q", app.readString(qs, "title", ""))
+	input.Query.Language = app.readString(qs, "lang", "")
+	input.Query.Tags = data.NormalizeTags(app.readCSV(qs, "tags", []string{}))
+	input.Query.TagMode = app.readString(qs, "tag_mode", data.TagModeAll)
+	input.Query.Author = app.readString(qs, "author", "")
+	input.Query.PublishedFrom = app.readDate(qs, "from", v)
+	input.Query.PublishedTo = app.readDate(qs, "to", v)
+	input.Query.MinClaps = int64(app.readInt(qs, "min_claps", 0, v))
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 5, v)
+	input.Filters.Sort = app.readString(qs, "sort", data.SortLatest)
+	input.Filters.SortSafelist = data.PostSortSafelist
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
 
+	data.ValidatePostQuery(v, input.Query)
 	data.ValidateFilters(v, input.Filters)
 
 	if !v.Valid() {
@@ -57,7 +129,56 @@ func (app *application) ListPostsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	posts, metadata, err := app.models.Posts.GetAll(input.Title, input.Tags, input.Filters)
+	// without a language, a search that clearly is in one is limited to the posts in it,
+	// otherwise the posts of every language are searched
+	if input.Query.Language == "" {
+		if lang, ok := data.DetectLanguage(input.Query.Search, 2); ok {
+			input.Query.Language = lang
+		}
+	}
+
+	// searching for golang finds the posts tagged go
+	tags, err := app.models.Tags.ResolveAliases(input.Query.Tags)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.Query.Tags = tags
+
+	posts, metadata, err := app.models.Posts.GetAll(input.Query, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrInvalidSort):
+			app.failedValidationResponse(w, r, map[string]string{"sort": "invalid sort value"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.loadCoverImages(posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.loadBookmarks(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostReactions(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadSearchMatches(input.Query.Search, posts...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -73,10 +194,12 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	user := app.contextGetUser(r)
 
 	var input struct {
-		Title    string   `json:"title"`
-		Subtitle string   `json:"subtitle"`
-		Content  string   `json:"content"`
-		Tags     []string `json:"tags"`
+		Title        string   `json:"title"`
+		Subtitle     string   `json:"subtitle"`
+		Content      string   `json:"content"`
+		Tags         []string `json:"tags"`
+		Language     string   `json:"language"` // detected from the text when not given
+		CoverImageID *int64   `json:"cover_image_id"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -90,20 +213,47 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		Subtitle: input.Subtitle,
 		Tags:     input.Tags,
 		Content:  input.Content,
+		Language: input.Language,
 		UserID:   user.ID,
 	}
 
+	post.DetectLanguage()
+
 	v := validator.New()
 
+	if input.CoverImageID != nil {
+		err = app.checkCoverImage(v, *input.CoverImageID, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		post.CoverImageID = input.CoverImageID
+	}
+
 	data.ValidatePost(v, post)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// aliases like golang are stored as the tag they stand for
+	post.Tags, err = app.models.Tags.Resolve(post.Tags)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	post.GenerateSlug()
 
-	err = app.models.Posts.Insert(post)
+	text := postSpamText(post)
+
+	verdict, err := app.checkSpam(r.Context(), data.HoldTargetPost, text, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Posts.Insert(post, spamHold(data.HoldTargetPost, text, user, verdict))
 
 	if err != nil {
 		switch {
@@ -117,6 +267,24 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = app.recordFingerprint(text, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	post.Mentions, err = app.syncMentions(data.MentionTargetPost, post.ID, post.Content, post.Held, user, post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadCoverImages(post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"post": post}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -142,17 +310,59 @@ func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	user := app.contextGetUser(r)
-	if post.UserID != user.ID {
-		app.notPermittedResponse(w, r)
+
+	if post.Status == data.StatusPublished {
+		app.resourceConflictResponse(w, r, "post is already published")
 		return
 	}
 
-	if post.Status == "published" {
-		app.resourceConflictResponse(w, r, "post is already published")
+	if post.Held {
+		app.resourceConflictResponse(w, r, "post is held for review by a moderator")
+		return
+	}
+
+	if post.Hidden {
+		app.resourceConflictResponse(w, r, "post was hidden by a moderator and can't be published")
 		return
 	}
 
-	err = app.models.Posts.Publish(post)
+	// with review mode enabled, only editors can publish, and only posts that were approved by a reviewer
+	if app.cfg.review.enabled {
+		var permissions data.Permissions
+
+		permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(data.PermissionPostsPublish) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		if post.Status != data.StatusApproved {
+			app.resourceConflictResponse(w, r, "post must be approved by a reviewer before it can be published")
+			return
+		}
+
+		err = app.models.Posts.PublishApproved(post)
+	} else {
+		var canEdit bool
+
+		canEdit, err = app.canEditPost(post, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !canEdit {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		err = app.models.Posts.Publish(post, user.ID)
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -163,6 +373,12 @@ func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// the publication is already committed, failing to notify the mentioned users doesn't undo it
+	err = app.notifyPublishedMentions(post)
+	if err != nil {
+		app.logger.Error("failed to notify the mentions of a published post", "post_id", post.ID, "error", err.Error())
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully published"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -187,16 +403,30 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	user := app.contextGetUser(r)
-	if post.UserID != user.ID {
+
+	canEdit, err := app.canEditPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canEdit {
 		app.notPermittedResponse(w, r)
 		return
 	}
 
+	// the moderator reviews the post as it was held, so it can't change until it's reviewed
+	if post.Held {
+		app.resourceConflictResponse(w, r, "post is held for review by a moderator and can't be edited")
+		return
+	}
+
 	var input struct {
-		Title    *string  `json:"title"`
-		Subtitle *string  `json:"subtitle"`
-		Content  *string  `json:"content"`
-		Tags     []string `json:"tags"`
+		Title        *string  `json:"title"`
+		Subtitle     *string  `json:"subtitle"`
+		Content      *string  `json:"content"`
+		Tags         []string `json:"tags"`
+		Language     *string  `json:"language"`
+		CoverImageID *int64   `json:"cover_image_id"` // 0 removes the cover image
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -205,7 +435,7 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	oldTitle := post.Title
+	old := *post
 
 	// we are only updating the values that are not nil, the ones user provided
 	if input.Title != nil {
@@ -220,13 +450,31 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if input.Tags != nil {
 		post.Tags = input.Tags
 	}
+	if input.Language != nil {
+		post.Language = *input.Language
+	}
 
-	if input.Title != nil && post.Title != oldTitle {
+	if input.Title != nil && post.Title != old.Title {
 		post.GenerateSlug() // only generating the slug, if the title was changed
 	}
 
 	v := validator.New()
 
+	if input.CoverImageID != nil {
+		switch *input.CoverImageID {
+		case 0:
+			post.CoverImageID = nil
+		default:
+			// the image can come from the author or from the co-author who is editing the post
+			err = app.checkCoverImage(v, *input.CoverImageID, post.UserID, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			post.CoverImageID = input.CoverImageID
+		}
+	}
+
 	data.ValidatePost(v, post)
 
 	if !v.Valid() {
@@ -234,7 +482,39 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Posts.Update(post, user.ID)
+	// aliases like golang are stored as the tag they stand for
+	post.Tags, err = app.models.Tags.Resolve(post.Tags)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// with review mode enabled, a submitted or approved post goes back to draft when anything the
+	// reviewer signed off on changes. Other edits, like fixing the language, keep the review.
+	if app.cfg.review.enabled && (post.Status == data.StatusInReview || post.Status == data.StatusApproved) && !sameReviewedContent(&old, post) {
+		post.Status = data.StatusDraft
+	}
+
+	// an edit goes through the spam checks like a new post, or spam could be edited into a harmless post
+	text := postSpamText(post)
+	textChanged := text != postSpamText(&old)
+
+	var hold *data.SpamHold
+
+	if textChanged {
+		verdict, err := app.checkSpam(r.Context(), data.HoldTargetPost, text, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// a held post can't stay published, it goes back to draft until a moderator approves it
+		if hold = spamHold(data.HoldTargetPost, text, user, verdict); hold != nil {
+			post.Status = data.StatusDraft
+		}
+	}
+
+	err = app.models.Posts.Update(post, user.ID, hold)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -248,46 +528,69 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"post": post}, nil)
+	switch {
+	case post.Held:
+		app.related.remove(post.ID)
+	case !slices.Equal(old.Tags, post.Tags):
+		// the related posts are found through the tags, so they have to be looked up again
+		app.related.invalidate(post.ID)
+	}
+
+	if textChanged {
+		err = app.recordFingerprint(text, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	post.Mentions, err = app.syncMentions(data.MentionTargetPost, post.ID, post.Content, post.Held, user, post)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
-}
 
-func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	user := app.contextGetUser(r)
+	err = app.loadCoverImages(post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	id, err := app.readIDParam(r)
+	claps, err := app.models.Claps.GetForUser(post.ID, user.ID)
 	if err != nil {
-		app.notfoundResponse(w, r)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
+	post.ViewerClaps = &claps
 
-	err = app.models.Posts.Delete(id, user.ID)
+	err = app.loadBookmarks(user.ID, post)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notfoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully deleted"}, nil)
+	err = app.loadPostReactions(user.ID, post)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"post": post}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) clapPostHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notfoundResponse(w, r)
 		return
 	}
 
-	err = app.models.Posts.IncrementClap(id)
+	err = app.models.Posts.Delete(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -298,8 +601,23 @@ func (app *application) clapPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully clapped the post"}, nil)
+	app.related.remove(id)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// sameReviewedContent reports whether two versions of a post have the same title, subtitle, content,
+// tags and cover image, which is what a reviewer approves
+func sameReviewedContent(a, b *data.Post) bool {
+	sameCover := (a.CoverImageID == nil && b.CoverImageID == nil) ||
+		(a.CoverImageID != nil && b.CoverImageID != nil && *a.CoverImageID == *b.CoverImageID)
+
+	return a.Title == b.Title &&
+		a.Subtitle == b.Subtitle &&
+		a.Content == b.Content &&
+		slices.Equal(a.Tags, b.Tags) &&
+		sameCover
+}
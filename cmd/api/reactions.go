@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+// addReactionHandler returns a handler adding a reaction of the user to a post or a comment,
+// depending on targetType
+func (app *application) addReactionHandler(targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		targetID, ok := app.readReactionTarget(w, r, targetType)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Emoji string `json:"emoji"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateReaction(v, input.Emoji, app.cfg.reactions.emoji); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Reactions.Insert(targetType, targetID, user.ID, input.Emoji)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateReaction):
+				app.resourceConflictResponse(w, r, "you already reacted with this emoji")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.writeReactions(w, r, targetType, targetID, http.StatusCreated)
+	}
+}
+
+// removeReactionHandler returns a handler removing the reaction in {emoji} of the user from a post or
+// a comment, depending on targetType
+func (app *application) removeReactionHandler(targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		targetID, ok := app.readReactionTarget(w, r, targetType)
+		if !ok {
+			return
+		}
+
+		// emoji are percent-encoded in the URL
+		emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+		if err != nil {
+			app.notfoundResponse(w, r)
+			return
+		}
+
+		err = app.models.Reactions.Delete(targetType, targetID, user.ID, emoji)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notfoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		app.writeReactions(w, r, targetType, targetID, http.StatusOK)
+	}
+}
+
+// writeReactions responds with the up to date reactions of a target
+func (app *application) writeReactions(w http.ResponseWriter, r *http.Request, targetType string, targetID int64, status int) {
+	user := app.contextGetUser(r)
+
+	summary := &data.ReactionSummary{Reactions: map[string]int{}, ViewerReactions: []string{}}
+
+	err := app.models.Reactions.Load(targetType, user.ID, map[int64]*data.ReactionSummary{targetID: summary})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, status, envelope{"reactions": summary.Reactions, "viewer_reactions": summary.ViewerReactions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readReactionTarget returns the id of the post in {id}, or of the comment in {comment_id} of that
+// post. If the target doesn't exist or the user can't see it, a not found response is sent and ok is false.
+func (app *application) readReactionTarget(w http.ResponseWriter, r *http.Request, targetType string) (int64, bool) {
+	user := app.contextGetUser(r)
+
+	postID, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return 0, false
+	}
+
+	post, err := app.models.Posts.Get(postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, false
+	}
+
+	// a post hidden by a moderator or held for review, like a held comment, is only seen by its author
+	if (post.Hidden || post.Held) && post.UserID != user.ID {
+		app.notfoundResponse(w, r)
+		return 0, false
+	}
+
+	if targetType == data.ReactionTargetPost {
+		return post.ID, true
+	}
+
+	commentID, err := app.readNamedIDParam(r, "comment_id")
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return 0, false
+	}
+
+	comment, err := app.models.Comments.Get(commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, false
+	}
+
+	if comment.PostID != postID || comment.Deleted || (comment.Held && comment.UserID != user.ID) {
+		app.notfoundResponse(w, r)
+		return 0, false
+	}
+
+	return comment.ID, true
+}
+
+// loadPostReactions fills in the reactions of posts, as seen by the user
+func (app *application) loadPostReactions(userID int64, posts ...*data.Post) error {
+	targets := make(map[int64]*data.ReactionSummary, len(posts))
+	for _, post := range posts {
+		targets[post.ID] = &post.ReactionSummary
+	}
+
+	return app.models.Reactions.Load(data.ReactionTargetPost, userID, targets)
+}
+
+// loadCommentReactions fills in the reactions of comments, as seen by the user
+func (app *application) loadCommentReactions(userID int64, comments ...*data.Comment) error {
+	targets := make(map[int64]*data.ReactionSummary, len(comments))
+	for _, comment := range comments {
+		targets[comment.ID] = &comment.ReactionSummary
+	}
+
+	return app.models.Reactions.Load(data.ReactionTargetComment, userID, targets)
+}
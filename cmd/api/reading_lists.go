@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+func (app *application) listReadingListsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// making sure that the default list shows up even before anything was saved to it
+	_, err := app.models.ReadingLists.GetDefault(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lists, err := app.models.ReadingLists.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reading_lists": lists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.ReadingList{
+		UserID: user.ID,
+		Name:   strings.TrimSpace(input.Name),
+	}
+
+	v := validator.New()
+
+	if data.ValidateReadingList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ReadingLists.Insert(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReadingList):
+			v.AddError("name", "a reading list with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"reading_list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showReadingListHandler returns a list of the user along with a page of its posts
+func (app *application) showReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.getOwnedReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.After = app.readString(qs, "after", "")
+	filters.Before = app.readString(qs, "before", "")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	posts, metadata, err := app.models.ReadingLists.GetPosts(list.ID, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.loadCoverImages(posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadBookmarks(list.UserID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostReactions(list.UserID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reading_list": list, "posts": posts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReadingListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.getOwnedReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	if list.IsDefault {
+		app.badRequestResponse(w, r, errors.New("the default reading list can't be deleted"))
+		return
+	}
+
+	err := app.models.ReadingLists.Delete(list.ID, list.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "reading list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addReadingListPostHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.getOwnedReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PostID int64 `json:"post_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	err = app.checkSavablePost(v, input.PostID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ReadingLists.AddPost(list.ID, input.PostID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully saved to the reading list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeReadingListPostHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.getOwnedReadingList(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := app.readNamedIDParam(r, "post_id")
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	err = app.models.ReadingLists.RemovePost(list.ID, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully removed from the reading list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bookmarkPostHandler saves a post to the default reading list of the user
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if post.Status != data.StatusPublished {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	list, err := app.models.ReadingLists.GetDefault(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.ReadingLists.AddPost(list.ID, post.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully bookmarked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unbookmarkPostHandler removes a post from all the reading lists of the user
+func (app *application) unbookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	err = app.models.ReadingLists.RemoveBookmark(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "bookmark successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOwnedReadingList fetches the reading list from the {id} URL parameter. Reading lists are
+// private, so the lists of other users are reported as not found.
+func (app *application) getOwnedReadingList(w http.ResponseWriter, r *http.Request) (*data.ReadingList, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	list, err := app.models.ReadingLists.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return list, true
+}
+
+// checkSavablePost makes sure that the post to be saved to a reading list exists and is
+// published, otherwise an error is added to v
+func (app *application) checkSavablePost(v *validator.Validator, id int64) error {
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("post_id", "must be an existing post")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	v.Check(post.Status == data.StatusPublished, "post_id", "must be a published post")
+
+	return nil
+}
+
+// loadBookmarks sets whether each of posts was saved to a reading list of the user
+func (app *application) loadBookmarks(userID int64, posts ...*data.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+
+	bookmarked, err := app.models.ReadingLists.GetBookmarked(userID, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		saved := bookmarked[post.ID]
+		post.Bookmarked = &saved
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// maxRelatedPosts is the most related posts that can be requested, and how many are cached per post
+const maxRelatedPosts = 20
+
+// relatedCache keeps the related posts of recently viewed posts. An entry is dropped when the tags
+// of its post change, when it expires, since the other posts keep changing too, and when it's the
+// least recently used one and the cache is full.
+type relatedCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[int64]*list.Element
+	lru     *list.List // of *relatedEntry, the most recently used first
+}
+
+type relatedEntry struct {
+	id      int64
+	posts   []*data.Post
+	expires time.Time
+}
+
+func newRelatedCache(size int) *relatedCache {
+	return &relatedCache{size: size, entries: make(map[int64]*list.Element), lru: list.New()}
+}
+
+func (c *relatedCache) get(id int64) ([]*data.Post, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*relatedEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, id)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.posts, true
+}
+
+func (c *relatedCache) set(id int64, posts []*data.Post, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		c.lru.Remove(elem)
+	}
+
+	c.entries[id] = c.lru.PushFront(&relatedEntry{id: id, posts: posts, expires: time.Now().Add(ttl)})
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*relatedEntry).id)
+	}
+}
+
+// invalidate drops the related posts of a post
+func (c *relatedCache) invalidate(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, id)
+	}
+}
+
+// remove drops a post which was deleted or taken down from the cache, along with the related posts
+// of the other posts it's one of
+func (c *relatedCache) remove(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*relatedEntry)
+
+		if entry.id == id || slices.ContainsFunc(entry.posts, func(p *data.Post) bool { return p.ID == id }) {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.id)
+		}
+
+		elem = next
+	}
+}
+
+func (app *application) listRelatedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	limit := app.readInt(r.URL.Query(), "limit", 5, v)
+
+	v.Check(limit >= 1, "limit", "must be greater than zero")
+	v.Check(limit <= maxRelatedPosts, "limit", fmt.Sprintf("must be a maximum of %d", maxRelatedPosts))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	cached, ok := app.related.get(id)
+	if !ok {
+		_, err = app.models.Posts.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notfoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		cached, err = app.models.Posts.GetRelated(id, maxRelatedPosts)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.related.set(id, cached, app.cfg.related.cacheTTL)
+	}
+
+	// the cached posts are shared between requests, so the viewer specific fields are set on copies
+	posts := make([]*data.Post, 0, min(limit, len(cached)))
+	for _, p := range cached[:min(limit, len(cached))] {
+		post := *p
+		posts = append(posts, &post)
+	}
+
+	err = app.loadCoverImages(posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadBookmarks(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostReactions(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"posts": posts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
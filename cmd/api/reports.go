@@ -0,0 +1,383 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		TargetType string `json:"target_type"`
+		TargetID   int64  `json:"target_id"`
+		Reason     string `json:"reason"`
+		Details    string `json:"details"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := &data.Report{
+		ReporterID: user.ID,
+		TargetType: input.TargetType,
+		TargetID:   input.TargetID,
+		Reason:     input.Reason,
+		Details:    input.Details,
+	}
+
+	v := validator.New()
+
+	if data.ValidateReport(v, report); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exists, err := app.reportTargetExists(report)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v.Check(exists, "target_id", "must be an existing "+report.TargetType)
+	if report.TargetType == data.ReportTargetUser {
+		v.Check(report.TargetID != user.ID, "target_id", "must not be yourself")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reports.Insert(report)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			app.resourceConflictResponse(w, r, "you have already reported this "+report.TargetType)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reportTargetExists reports whether the post, comment or user a report is about exists
+func (app *application) reportTargetExists(report *data.Report) (bool, error) {
+	var err error
+
+	switch report.TargetType {
+	case data.ReportTargetPost:
+		_, err = app.models.Posts.Get(report.TargetID)
+	case data.ReportTargetComment:
+		var comment *data.Comment
+		comment, err = app.models.Comments.Get(report.TargetID)
+		if err == nil && comment.Deleted {
+			return false, nil
+		}
+	case data.ReportTargetUser:
+		_, err = app.models.Users.Get(report.TargetID)
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// listReportsHandler returns the moderation queue, the open reports by default
+func (app *application) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query   data.ReportQuery
+		Filters data.Filter
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query.Status = app.readString(qs, "status", data.ReportOpen)
+	input.Query.TargetType = app.readString(qs, "target_type", "")
+	input.Query.Reason = app.readString(qs, "reason", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = data.ReportSortSafelist
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
+
+	// status=all lists the whole history
+	if input.Query.Status == "all" {
+		input.Query.Status = ""
+	}
+
+	data.ValidateReportQuery(v, input.Query)
+	data.ValidateFilters(v, input.Filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reports, metadata, err := app.models.Reports.GetAll(input.Query, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrInvalidSort):
+			app.failedValidationResponse(w, r, map[string]string{"sort": "invalid sort value"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "reports": reports}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.getReport(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolveReportHandler dismisses a report, or acts on the reported content by hiding or deleting it or
+// suspending its author. The other open reports on the same content are resolved along with it, and
+// all of their reporters are emailed the outcome.
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := app.contextGetUser(r)
+
+	report, ok := app.getReport(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Resolution string `json:"resolution"`
+		Note       string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateResolution(v, report.TargetType, input.Resolution, input.Note); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if report.Status != data.ReportOpen {
+		app.resourceConflictResponse(w, r, "the report has already been resolved")
+		return
+	}
+
+	// the text is fetched before the content may be deleted, for the classifier to learn from
+	text, learn, err := app.reportedSpamText(report)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the report is resolved along with the action, so that two moderators can't both act on it
+	var notices []*data.ReportNotice
+
+	if input.Resolution == data.ResolutionDismiss {
+		notices, err = app.models.Reports.Resolve(report, input.Resolution, moderator.ID, input.Note)
+	} else {
+		notices, err = app.actOnReport(report, input.Resolution, moderator.ID, input.Note)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceConflictResponse(w, r, "the reported "+report.TargetType+" no longer exists, the report can only be dismissed")
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if learn {
+		app.learnFromReport(report, text)
+	}
+
+	app.background(func() {
+		for _, notice := range notices {
+			data := map[string]any{
+				"username":   notice.Username,
+				"reportID":   notice.ReportID,
+				"targetType": report.TargetType,
+				"status":     report.Status,
+				"note":       report.Note,
+			}
+
+			err := app.mailer.Send(notice.Email, "report_resolved.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report, "resolved_reports": len(notices)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// actOnReport hides or deletes the reported post or comment, or suspends the reported user or the
+// author of the reported content. The action is logged with the report and the moderator's note, and
+// the report is resolved in the same transaction. It returns the reporters to notify, ErrRecordNotFound
+// when the content is already gone and ErrEditConflict when the report was already resolved.
+func (app *application) actOnReport(report *data.Report, resolution string, moderatorID int64, note string) ([]*data.ReportNotice, error) {
+	moderation := &data.ModerationAction{
+		ModeratorID: moderatorID,
+		ReportID:    &report.ID,
+		Reason:      note,
+		Resolves:    &data.ReportResolution{Report: report, Resolution: resolution},
+	}
+
+	var err error
+
+	switch report.TargetType {
+	case data.ReportTargetPost:
+		var post *data.Post
+		post, err = app.models.Posts.Get(report.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		moderation.PostID = &post.ID
+
+		switch resolution {
+		case data.ResolutionHide:
+			moderation.Action = data.ActionHidePost
+			defer app.related.remove(post.ID)
+			err = app.models.Moderation.HidePost(post.ID, moderation)
+		case data.ResolutionDelete:
+			moderation.Action = data.ActionDeletePost
+			defer app.related.remove(post.ID)
+			err = app.models.Moderation.DeletePost(post.ID, moderation)
+		default:
+			moderation.Action = data.ActionSuspendUser
+			moderation.UserID = &post.UserID
+			err = app.models.Moderation.SuspendUser(post.UserID, moderation)
+		}
+
+	case data.ReportTargetComment:
+		var comment *data.Comment
+		comment, err = app.models.Comments.Get(report.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		if comment.Deleted {
+			return nil, data.ErrRecordNotFound
+		}
+		moderation.PostID = &comment.PostID
+		moderation.CommentID = &comment.ID
+
+		switch resolution {
+		case data.ResolutionHide:
+			moderation.Action = data.ActionHideComment
+			err = app.models.Comments.SetHidden(comment, true, moderation)
+		case data.ResolutionDelete:
+			moderation.Action = data.ActionDeleteComment
+			err = app.models.Comments.Delete(comment.ID, comment.PostID, moderation)
+		default:
+			moderation.Action = data.ActionSuspendUser
+			moderation.UserID = &comment.UserID
+			err = app.models.Moderation.SuspendUser(comment.UserID, moderation)
+		}
+
+	default:
+		moderation.Action = data.ActionSuspendUser
+		moderation.UserID = &report.TargetID
+		err = app.models.Moderation.SuspendUser(report.TargetID, moderation)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return moderation.Resolves.Notices, nil
+}
+
+// reportedSpamText returns the text of a post or comment reported as spam. ok is false for other
+// reports, and when the content is already gone.
+func (app *application) reportedSpamText(report *data.Report) (text string, ok bool, err error) {
+	if report.Reason != "spam" {
+		return "", false, nil
+	}
+
+	switch report.TargetType {
+	case data.ReportTargetPost:
+		var post *data.Post
+		post, err = app.models.Posts.Get(report.TargetID)
+		if err == nil {
+			text = post.Title + "\n" + post.Content
+		}
+	case data.ReportTargetComment:
+		var comment *data.Comment
+		comment, err = app.models.Comments.Get(report.TargetID)
+		if err == nil && !comment.Deleted {
+			text = comment.Body
+		}
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return "", false, nil
+	case err != nil:
+		return "", false, err
+	default:
+		return text, text != "", nil
+	}
+}
+
+func (app *application) getReport(w http.ResponseWriter, r *http.Request) (*data.Report, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return nil, false
+	}
+
+	report, err := app.models.Reports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return report, true
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// canReviewPost reports whether the user can review the post, either as an accepted reviewer
+// of the post or through the posts:review permission. Authors can't review their own posts.
+func (app *application) canReviewPost(post *data.Post, user *data.User) (bool, error) {
+	if post.UserID == user.ID {
+		return false, nil
+	}
+
+	collaborator, err := app.models.Collaborators.Get(post.ID, user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if collaborator != nil && collaborator.Accepted && collaborator.Role == data.RoleReviewer {
+		return true, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(data.PermissionPostsReview), nil
+}
+
+func (app *application) submitPostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	canEdit, err := app.canEditPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canEdit {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if post.Status != data.StatusDraft {
+		app.resourceConflictResponse(w, r, "only drafts can be submitted for review")
+		return
+	}
+
+	if post.Hidden {
+		app.resourceConflictResponse(w, r, "post was hidden by a moderator and can't be published")
+		return
+	}
+
+	err = app.models.Posts.SetStatus(post, data.StatusInReview)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully submitted for review"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reviewPostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	canReview, err := app.canReviewPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canReview {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if post.Status != data.StatusInReview {
+		app.resourceConflictResponse(w, r, "post is not submitted for review")
+		return
+	}
+
+	var input struct {
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		PostID:     post.ID,
+		ReviewerID: user.ID,
+		Reviewer:   user.Username,
+		Decision:   input.Decision,
+		Comment:    input.Comment,
+	}
+
+	v := validator.New()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review, post)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review, "status": post.Status}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPostReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// reviews are visible to the people who can edit the post and to reviewers
+	user := app.contextGetUser(r)
+
+	canEdit, err := app.canEditPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !canEdit {
+		canReview, err := app.canReviewPost(post, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !canReview {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	reviews, err := app.models.Reviews.GetAllForPost(post.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
@@ -25,12 +27,23 @@ func (app *application) routes() http.Handler {
 
 	r.Handle("/metrics", promhttp.Handler())
 
+	// files of the local storage are served by the API itself
+	if local, ok := app.storage.(*storage.Local); ok {
+		r.Handle("/uploads/*", app.serveUploads(local))
+	}
+
 	// USERS endpoints
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", app.registerUserHandler)
 		r.Put("/activated", app.activateUserHandler)
 		r.Get("/me", app.getProfileHandler)
 		r.Patch("/", app.requireActivatedUser(app.updateProfileHandler))
+		r.Get("/me/tags", app.requireActivatedUser(app.listFollowedTagsHandler))
+		r.Get("/me/blocks", app.requireActivatedUser(app.listBlockedUsersHandler))
+		r.Post("/me/blocks", app.requireActivatedUser(app.blockUserHandler))
+		r.Delete("/me/blocks/{user_id}", app.requireActivatedUser(app.unblockUserHandler))
+		r.Put("/me/digest", app.requireActivatedUser(app.updateDigestHandler))
+		r.Put("/digest/unsubscribed", app.unsubscribeDigestHandler)
 	})
 
 	// TOKENS endpoints
@@ -49,16 +62,102 @@ func (app *application) routes() http.Handler {
 			r.Delete("/", app.requireActivatedUser(app.deletePostHandler))
 
 			r.Post("/publish", app.requireActivatedUser(app.publishPostHandler))
+			r.Get("/stats", app.requireActivatedUser(app.postStatsHandler))
+			r.Get("/related", app.requireActivatedUser(app.listRelatedPostsHandler))
+			r.Post("/submit", app.requireActivatedUser(app.submitPostHandler))
+			r.Post("/reviews", app.requireActivatedUser(app.reviewPostHandler))
+			r.Get("/reviews", app.requireActivatedUser(app.listPostReviewsHandler))
 			r.Post("/clap", app.requireActivatedUser(app.clapPostHandler))
+			r.Delete("/clap", app.requireActivatedUser(app.unclapPostHandler))
+			r.Post("/bookmark", app.requireActivatedUser(app.bookmarkPostHandler))
+			r.Delete("/bookmark", app.requireActivatedUser(app.unbookmarkPostHandler))
+			r.Post("/reactions", app.requireActivatedUser(app.addReactionHandler(data.ReactionTargetPost)))
+			r.Delete("/reactions/{emoji}", app.requireActivatedUser(app.removeReactionHandler(data.ReactionTargetPost)))
+			r.Get("/moderation", app.requireActivatedUser(app.listModerationActionsHandler))
+
+			r.Route("/collaborators", func(r chi.Router) {
+				r.Post("/", app.requireActivatedUser(app.inviteCollaboratorHandler))
+				r.Get("/", app.requireActivatedUser(app.listCollaboratorsHandler))
+				r.Put("/accepted", app.requireActivatedUser(app.acceptCollaborationHandler))
+				r.Delete("/{user_id}", app.requireActivatedUser(app.removeCollaboratorHandler))
+			})
 
 			r.Route("/comments", func(r chi.Router) {
 				r.Post("/", app.requireActivatedUser(app.createCommentHandler))
 				r.Get("/", app.requireActivatedUser(app.listCommentsForPostHandler))
+				r.Put("/mode", app.requireActivatedUser(app.setCommentsModeHandler))
 				r.Delete("/{comment_id}", app.requireActivatedUser(app.deleteCommentHandler))
 				r.Patch("/{comment_id}", app.requireActivatedUser(app.updateCommentHandler))
+				r.Put("/{comment_id}/hidden", app.requireActivatedUser(app.hideCommentHandler))
+				r.Post("/{comment_id}/reactions", app.requireActivatedUser(app.addReactionHandler(data.ReactionTargetComment)))
+				r.Delete("/{comment_id}/reactions/{emoji}", app.requireActivatedUser(app.removeReactionHandler(data.ReactionTargetComment)))
 			})
 		})
 	})
 
+	// MEDIA endpoints
+	r.Route("/media", func(r chi.Router) {
+		r.Post("/", app.requireActivatedUser(app.uploadMediaHandler))
+		r.Get("/{id}", app.requireActivatedUser(app.showMediaHandler))
+		r.Delete("/{id}", app.requireActivatedUser(app.deleteMediaHandler))
+	})
+
+	// SERIES endpoints
+	r.Route("/series", func(r chi.Router) {
+		r.Post("/", app.requireActivatedUser(app.createSeriesHandler))
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", app.requireActivatedUser(app.showSeriesHandler))
+			r.Delete("/", app.requireActivatedUser(app.deleteSeriesHandler))
+
+			r.Post("/posts", app.requireActivatedUser(app.addSeriesPostHandler))
+			r.Put("/posts", app.requireActivatedUser(app.reorderSeriesPostsHandler))
+			r.Delete("/posts/{post_id}", app.requireActivatedUser(app.removeSeriesPostHandler))
+		})
+	})
+
+	// SEARCH endpoints
+	r.Route("/search", func(r chi.Router) {
+		r.Get("/suggest", app.requireActivatedUser(app.searchSuggestHandler))
+	})
+
+	// TAGS endpoints
+	r.Route("/tags", func(r chi.Router) {
+		r.Get("/", app.requireActivatedUser(app.listTagsHandler))
+		r.Get("/{slug}", app.requireActivatedUser(app.showTagHandler))
+		r.Patch("/{slug}", app.requirePermission(data.PermissionTagsManage, app.updateTagHandler))
+		r.Post("/{slug}/aliases", app.requirePermission(data.PermissionTagsManage, app.addTagAliasHandler))
+		r.Post("/{slug}/follow", app.requireActivatedUser(app.followTagHandler))
+		r.Delete("/{slug}/follow", app.requireActivatedUser(app.unfollowTagHandler))
+	})
+
+	// REPORTS endpoints
+	r.Route("/reports", func(r chi.Router) {
+		r.Post("/", app.requireActivatedUser(app.createReportHandler))
+		r.Get("/", app.requirePermission(data.PermissionReportsModerate, app.listReportsHandler))
+		r.Get("/{id}", app.requirePermission(data.PermissionReportsModerate, app.showReportHandler))
+		r.Post("/{id}/resolve", app.requirePermission(data.PermissionReportsModerate, app.resolveReportHandler))
+	})
+
+	// SPAM endpoints
+	r.Route("/spam/holds", func(r chi.Router) {
+		r.Get("/", app.requirePermission(data.PermissionReportsModerate, app.listSpamHoldsHandler))
+		r.Post("/{id}/review", app.requirePermission(data.PermissionReportsModerate, app.reviewSpamHoldHandler))
+	})
+
+	// READING LISTS endpoints
+	r.Route("/reading-lists", func(r chi.Router) {
+		r.Get("/", app.requireActivatedUser(app.listReadingListsHandler))
+		r.Post("/", app.requireActivatedUser(app.createReadingListHandler))
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", app.requireActivatedUser(app.showReadingListHandler))
+			r.Delete("/", app.requireActivatedUser(app.deleteReadingListHandler))
+
+			r.Post("/posts", app.requireActivatedUser(app.addReadingListPostHandler))
+			r.Delete("/posts/{post_id}", app.requireActivatedUser(app.removeReadingListPostHandler))
+		})
+	})
+
 	return r
 }
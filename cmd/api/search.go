@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// loadSearchMatches fills in why each of the posts matched the search, with highlighted snippets.
+// Nothing is loaded when there's no search.
+func (app *application) loadSearchMatches(search string, posts ...*data.Post) error {
+	if search == "" || len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+
+	opts := data.HighlightOptions{
+		StartMarker:  app.cfg.search.highlightStart,
+		StopMarker:   app.cfg.search.highlightStop,
+		MaxWords:     app.cfg.search.snippetWords,
+		MaxFragments: app.cfg.search.snippetFragments,
+	}
+
+	matches, err := app.models.Posts.GetSearchMatches(search, ids, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Search = matches[post.ID]
+	}
+
+	return nil
+}
+
+// searchSuggestHandler returns the posts, tags and authors matching what the user has typed so far,
+// for search-as-you-type. It answers within the suggest budget, with whatever was found by then.
+func (app *application) searchSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	q := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 5, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be longer than 100 characters")
+
+	v.Check(limit >= 1, "limit", "must be greater than zero")
+	v.Check(limit <= 10, "limit", "must be a maximum of 10")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Search.Suggest(q, limit, app.cfg.search.suggestTimeout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
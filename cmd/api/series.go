@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+func (app *application) createSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	series := &data.Series{
+		UserID:      user.ID,
+		Title:       input.Title,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	if data.ValidateSeries(v, series); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Series.Insert(series)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"series": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	series, err := app.models.Series.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	series.Posts, err = app.models.Series.GetPosts(series.ID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"series": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Series.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "series successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addSeriesPostHandler(w http.ResponseWriter, r *http.Request) {
+	series, ok := app.getOwnedSeries(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PostID int64 `json:"post_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	post, err := app.models.Posts.Get(input.PostID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("post_id", "must be an existing post")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// only the author of a post can add it to their series
+	if post.UserID != series.UserID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Series.AddPost(series, post.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		case errors.Is(err, data.ErrPostInSeries):
+			app.resourceConflictResponse(w, r, "post is already a part of a series")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	series.Posts, err = app.models.Series.GetPosts(series.ID, series.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"series": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderSeriesPostsHandler(w http.ResponseWriter, r *http.Request) {
+	series, ok := app.getOwnedSeries(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		PostIDs []int64 `json:"post_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	current, err := app.models.Series.GetPosts(series.ID, series.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the new order must be a permutation of the posts that are already in the series
+	ids := make([]int64, 0, len(current))
+	for _, p := range current {
+		ids = append(ids, p.ID)
+	}
+
+	sorted := slices.Clone(input.PostIDs)
+	slices.Sort(sorted)
+	slices.Sort(ids)
+
+	v := validator.New()
+
+	v.Check(validator.Unique(input.PostIDs), "post_ids", "must not contain duplicate values")
+	v.Check(slices.Equal(sorted, ids), "post_ids", "must contain every post of the series exactly once")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Series.Reorder(series, input.PostIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	series.Posts, err = app.models.Series.GetPosts(series.ID, series.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"series": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeSeriesPostHandler(w http.ResponseWriter, r *http.Request) {
+	series, ok := app.getOwnedSeries(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := app.readNamedIDParam(r, "post_id")
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Series.RemovePost(series.ID, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "post successfully removed from the series"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOwnedSeries fetches the series from the {id} URL parameter and makes sure that it belongs to the
+// current user. If it doesn't, an error response is sent and ok is false.
+func (app *application) getOwnedSeries(w http.ResponseWriter, r *http.Request) (*data.Series, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return nil, false
+	}
+
+	series, err := app.models.Series.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+	if series.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return series, true
+}
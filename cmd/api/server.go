@@ -42,6 +42,7 @@ func (app *application) serve() error {
 
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
+		close(app.shutdown)
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/spam"
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// fingerprintExpiryInterval is how often the fingerprints which fell out of the duplicate window are deleted
+const fingerprintExpiryInterval = time.Hour
+
+// newSpamPipeline returns the spam checks enabled in the config, an empty pipeline holds nothing
+func newSpamPipeline(cfg config, store data.SpamModel) *spam.Pipeline {
+	pipeline := &spam.Pipeline{Threshold: cfg.spam.threshold}
+
+	if !cfg.spam.enabled {
+		return pipeline
+	}
+
+	pipeline.Checkers = []spam.Checker{
+		spam.LinkCheck{MaxLinks: cfg.spam.maxLinks},
+		spam.BlocklistCheck{Words: cfg.spam.blockedWords, Domains: cfg.spam.blockedDomains},
+		spam.NewAccountCheck{MinAge: cfg.spam.newAccountAge},
+		spam.DuplicateCheck{Store: store, Window: cfg.spam.duplicateWindow, MaxCopies: cfg.spam.duplicateMaxCopies},
+		spam.BayesCheck{Store: store, MinDocuments: cfg.spam.classifierMinDocuments},
+	}
+
+	return pipeline
+}
+
+// checkSpam runs a new post or comment of the user through the spam checks
+func (app *application) checkSpam(ctx context.Context, kind, text string, user *data.User) (*spam.Verdict, error) {
+	content := &spam.Content{
+		Kind:            kind,
+		Text:            text,
+		AuthorID:        user.ID,
+		AuthorCreatedAt: user.CreatedAt,
+	}
+
+	return app.spam.Evaluate(ctx, content)
+}
+
+// postSpamText is the text of a post the spam checks look at
+func postSpamText(post *data.Post) string {
+	return post.Title + "\n" + post.Subtitle + "\n" + post.Content
+}
+
+// spamHold returns the hold of a new or edited post or comment the spam checks held for review, to be
+// saved along with it, and nil when the verdict was to let it through
+func spamHold(kind, text string, user *data.User, verdict *spam.Verdict) *data.SpamHold {
+	if !verdict.Held {
+		return nil
+	}
+
+	return &data.SpamHold{
+		TargetType: kind,
+		AuthorID:   user.ID,
+		Content:    text,
+		Score:      verdict.Score,
+		Signals:    verdict.Signals,
+	}
+}
+
+// recordFingerprint records the fingerprint of a post or comment which was just created or edited, so
+// that later copies of it are caught
+func (app *application) recordFingerprint(text string, user *data.User) error {
+	fingerprint := spam.Fingerprint(text)
+	if fingerprint == nil || !app.cfg.spam.enabled {
+		return nil
+	}
+
+	return app.models.Spam.RecordFingerprint(fingerprint, user.ID)
+}
+
+// startFingerprintExpiry forgets the fingerprints older than the duplicate window right away, and then
+// every fingerprintExpiryInterval until the server shuts down
+func (app *application) startFingerprintExpiry() {
+	if !app.cfg.spam.enabled {
+		return
+	}
+
+	app.background(func() {
+		ticker := time.NewTicker(fingerprintExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			count, err := app.models.Spam.DeleteExpiredFingerprints(time.Now().Add(-app.cfg.spam.duplicateWindow))
+			if err != nil {
+				app.logger.Error("failed to delete expired content fingerprints", "error", err.Error())
+			} else if count > 0 {
+				app.logger.Info("deleted expired content fingerprints", "count", count)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+// listSpamHoldsHandler returns the queue of content held for review, the held content by default
+func (app *application) listSpamHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status  string
+		Filters data.Filter
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", data.HoldHeld)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
+
+	data.ValidateHoldStatus(v, input.Status)
+	data.ValidateFilters(v, input.Filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	holds, metadata, err := app.models.Spam.GetHolds(input.Status, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reviewSpamHoldHandler approves held content, releasing it, or rejects it as spam, deleting it. The
+// classifier learns from either decision.
+func (app *application) reviewSpamHoldHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	hold, err := app.models.Spam.GetHold(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Decision string `json:"decision"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(validator.PermittedValue(input.Decision, data.DecisionApprove, data.DecisionReject), "decision", "must be either approve or reject"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if hold.Status != data.HoldHeld {
+		app.resourceConflictResponse(w, r, "the content has already been reviewed")
+		return
+	}
+
+	if input.Decision == data.DecisionApprove {
+		err = app.models.Spam.Review(hold, true, moderator.ID)
+	} else {
+		err = app.rejectSpam(hold, moderator.ID)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the approval is already committed, failing to notify the mentioned users doesn't undo it
+	if hold.Status == data.HoldApproved {
+		err = app.notifyApprovedMentions(hold)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("failed to notify the mentions of approved content", "hold_id", hold.ID, "error", err.Error())
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rejectSpam rejects held content as spam and deletes it, logging it as a moderation action. The hold
+// is rejected in the transaction deleting the content, so it's only deleted while it's still held. The
+// author may have deleted it in the meantime, which doesn't stop the classifier learning from it.
+func (app *application) rejectSpam(hold *data.SpamHold, moderatorID int64) error {
+	err := app.deleteSpam(hold, moderatorID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return app.models.Spam.Review(hold, false, moderatorID)
+	}
+
+	return err
+}
+
+// deleteSpam deletes held content rejected as spam, along with the rejection of its hold
+func (app *application) deleteSpam(hold *data.SpamHold, moderatorID int64) error {
+	moderation := &data.ModerationAction{
+		ModeratorID: moderatorID,
+		Reason:      "spam",
+		Rejects:     hold,
+	}
+
+	if hold.TargetType == data.HoldTargetPost {
+		moderation.PostID = &hold.TargetID
+		moderation.Action = data.ActionDeletePost
+		defer app.related.remove(hold.TargetID)
+		return app.models.Moderation.DeletePost(hold.TargetID, moderation)
+	}
+
+	comment, err := app.models.Comments.Get(hold.TargetID)
+	if err != nil {
+		return err
+	}
+	if comment.Deleted {
+		return data.ErrRecordNotFound
+	}
+
+	moderation.PostID = &comment.PostID
+	moderation.CommentID = &comment.ID
+	moderation.Action = data.ActionDeleteComment
+
+	return app.models.Comments.Delete(comment.ID, comment.PostID, moderation)
+}
+
+// learnFromReport trains the classifier on a post or comment reported as spam, as spam when the
+// moderator acted on the report and as ham when they dismissed it
+func (app *application) learnFromReport(report *data.Report, text string) {
+	isSpam := report.Status == data.ReportActioned
+
+	app.background(func() {
+		err := app.models.Spam.Train(spam.Tokenize(text), isSpam)
+		if err != nil {
+			app.logger.Error("failed to train the spam classifier", "report_id", report.ID, "error", err.Error())
+		}
+	})
+}
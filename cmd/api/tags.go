@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.After = app.readString(qs, "after", "")
+	filters.Before = app.readString(qs, "before", "")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tags, metadata, err := app.models.Tags.GetAll(filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTagHandler returns a tag along with a page of its published posts. Looking a tag up by one
+// of its aliases finds it as well.
+func (app *application) showTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.getTag(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filter
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 5, v)
+	filters.Sort = app.readString(qs, "sort", data.SortLatest)
+	filters.SortSafelist = data.PostSortSafelist
+	filters.After = app.readString(qs, "after", "")
+	filters.Before = app.readString(qs, "before", "")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	query := data.PostQuery{Tags: []string{tag.Slug}, TagMode: data.TagModeAll}
+
+	posts, metadata, err := app.models.Posts.GetAll(query, filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.loadCoverImages(posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadBookmarks(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.loadPostReactions(user.ID, posts...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag, "posts": posts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.getTag(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+	if input.Description != nil {
+		tag.Description = *input.Description
+	}
+
+	v := validator.New()
+
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.Update(tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addTagAliasHandler makes another name point to a tag. When that name is an existing tag,
+// the existing tag is merged into this one.
+func (app *application) addTagAliasHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.getTag(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Alias string `json:"alias"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	alias := data.NormalizeTag(input.Alias)
+
+	v := validator.New()
+
+	v.Check(alias != "", "alias", "must contain letters or digits")
+	v.Check(len(alias) <= 50, "alias", "must not be longer than 50 characters")
+	v.Check(alias != tag.Slug, "alias", "must be different from the tag")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.AddAlias(tag, alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAlias):
+			v.AddError("alias", "is already an alias of a tag")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// fetching the tag again, since a merge brings in posts and aliases
+	tag, err = app.models.Tags.GetBySlug(tag.Slug)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getTag fetches the tag from the {slug} URL parameter, sending a not found response if it doesn't exist
+func (app *application) getTag(w http.ResponseWriter, r *http.Request) (*data.Tag, bool) {
+	slug := data.NormalizeTag(chi.URLParam(r, "slug"))
+	if slug == "" {
+		app.notfoundResponse(w, r)
+		return nil, false
+	}
+
+	tag, err := app.models.Tags.GetBySlug(slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return tag, true
+}
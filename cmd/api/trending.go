@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// startTrendingJob recomputes the trending scores of posts right away, and then on every interval
+// until the server shuts down
+func (app *application) startTrendingJob() {
+	app.background(func() {
+		ticker := time.NewTicker(app.cfg.trending.interval)
+		defer ticker.Stop()
+
+		for {
+			app.refreshTrendingScores()
+
+			select {
+			case <-ticker.C:
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+func (app *application) refreshTrendingScores() {
+	start := time.Now()
+
+	// older activity would contribute less than 1% of its weight anyway
+	window := 7 * app.cfg.trending.halfLife
+
+	count, err := app.models.Posts.RefreshTrendingScores(app.cfg.trending.halfLife, window)
+	if err != nil {
+		app.logger.Error("failed to refresh trending scores", "error", err.Error())
+		return
+	}
+
+	app.logger.Info("refreshed trending scores", "posts", count, "duration", time.Since(start).String())
+}
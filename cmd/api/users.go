@@ -63,20 +63,17 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// sending mails in a separate go routine
-	app.wg.Add(1)
-	go func() {
-		defer app.wg.Done()
-
+	app.background(func() {
 		data := map[string]any{
 			"activationToken": token.Plaintext,
 			"username":        user.Username,
 		}
 
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
 		if err != nil {
 			app.logger.Error(err.Error())
 		}
-	}()
+	})
 
 	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+// viewBuffer collects post views in memory, so that they can be written to the database in batches
+// instead of with an insert on every read of a post
+type viewBuffer struct {
+	mu      sync.Mutex
+	secret  []byte               // key of the HMAC the readers are hashed with
+	seen    map[string]time.Time // when a reader last had a view of a post recorded, for deduplication
+	pending []data.PostView
+}
+
+func newViewBuffer(secret []byte) *viewBuffer {
+	return &viewBuffer{secret: secret, seen: make(map[string]time.Time)}
+}
+
+// recordView records a view of a post, unless the same reader already viewed it within the
+// deduplication window. Readers are identified by their user id, or by their IP address when
+// they aren't logged in. Both are hashed with an HMAC keyed with a server secret, since a plain
+// hash of an IPv4 address can be reversed by hashing all of them.
+func (app *application) recordView(r *http.Request, postID int64) {
+	user := app.contextGetUser(r)
+
+	viewer := "ip:" + realip.FromRequest(r)
+	if !user.IsAnonymous() {
+		viewer = fmt.Sprintf("user:%d", user.ID)
+	}
+
+	mac := hmac.New(sha256.New, app.views.secret)
+	mac.Write([]byte(viewer))
+	hash := hex.EncodeToString(mac.Sum(nil))
+
+	key := fmt.Sprintf("%d:%s", postID, hash)
+	now := time.Now()
+
+	app.views.mu.Lock()
+	defer app.views.mu.Unlock()
+
+	if last, ok := app.views.seen[key]; ok && now.Sub(last) < app.cfg.views.window {
+		return
+	}
+
+	app.views.seen[key] = now
+	app.views.pending = append(app.views.pending, data.PostView{PostID: postID, ViewerHash: hash, ViewedAt: now})
+
+	// not waiting for the next tick when the buffer is already full
+	if len(app.views.pending) >= app.cfg.views.batchSize {
+		batch := app.views.pending
+		app.views.pending = nil
+		app.background(func() { app.saveViews(batch) })
+	}
+}
+
+// startViewFlusher periodically writes the buffered views to the database. The remaining views are
+// written one last time when the server shuts down.
+func (app *application) startViewFlusher() {
+	app.background(func() {
+		ticker := time.NewTicker(app.cfg.views.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.flushViews()
+			case <-app.shutdown:
+				app.flushViews()
+				return
+			}
+		}
+	})
+}
+
+// flushViews writes the buffered views to the database, and forgets the readers whose deduplication
+// window has passed
+func (app *application) flushViews() {
+	app.views.mu.Lock()
+
+	batch := app.views.pending
+	app.views.pending = nil
+
+	now := time.Now()
+	for key, last := range app.views.seen {
+		if now.Sub(last) >= app.cfg.views.window {
+			delete(app.views.seen, key)
+		}
+	}
+
+	app.views.mu.Unlock()
+
+	app.saveViews(batch)
+}
+
+func (app *application) saveViews(batch []data.PostView) {
+	err := app.models.Views.InsertBatch(batch)
+	if err != nil {
+		app.logger.Error("failed to save post views", "count", len(batch), "error", err.Error())
+	}
+}
+
+// postStatsHandler returns the views, readers, claps and comments of a post over the last days,
+// for its author and co-authors
+func (app *application) postStatsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notfoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	days := app.readInt(r.URL.Query(), "days", 30, v)
+
+	v.Check(days >= 1, "days", "must be greater than zero")
+	v.Check(days <= 365, "days", "must be a maximum of 365")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	post, err := app.models.Posts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notfoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	canEdit, err := app.canEditPost(post, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !canEdit {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	stats, err := app.models.Views.GetStats(post.ID, days)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
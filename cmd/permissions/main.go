@@ -0,0 +1,113 @@
+// Command permissions grants and revokes the permissions of a user, e.g. making someone an editor
+// with posts:publish or a moderator with reports:moderate. It talks to the database directly, since
+// no user of the API can hand out permissions.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/data"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	var (
+		dsn      string
+		username string
+		grant    string
+		revoke   string
+	)
+
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("GOBLOG_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&username, "username", "", "User whose permissions are changed")
+	flag.StringVar(&grant, "grant", "", "Comma separated permissions to grant, one of "+strings.Join(data.AllPermissions, ", "))
+	flag.StringVar(&revoke, "revoke", "", "Comma separated permissions to revoke")
+	flag.Parse()
+
+	err := run(dsn, username, splitCSV(grant), splitCSV(revoke))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn, username string, grant, revoke []string) error {
+	if username == "" {
+		return errors.New("-username must be provided")
+	}
+
+	for _, code := range slices.Concat(grant, revoke) {
+		if !slices.Contains(data.AllPermissions, code) {
+			return fmt.Errorf("unknown permission %q, must be one of %s", code, strings.Join(data.AllPermissions, ", "))
+		}
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	models := data.NewModels(db)
+
+	user, err := models.Users.GetByUsername(username)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return fmt.Errorf("no user with the username %q exists", username)
+		default:
+			return err
+		}
+	}
+
+	if len(grant) > 0 {
+		err = models.Permissions.AddForUser(user.ID, grant...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(revoke) > 0 {
+		err = models.Permissions.RemoveForUser(user.ID, revoke...)
+		if err != nil {
+			return err
+		}
+	}
+
+	permissions, err := models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has the permissions: %s\n", user.Username, strings.Join(permissions, ", "))
+	return nil
+}
+
+// splitCSV splits a comma separated flag value, dropping empty values
+func splitCSV(value string) []string {
+	values := []string{}
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrClapLimitReached = errors.New("clap limit reached")
+
+// ClapModel keeps track of how many times each user clapped a post. The total in posts.claps
+// is maintained by a trigger on the post_claps table.
+type ClapModel struct {
+	DB *sql.DB
+}
+
+// Add adds n claps of the user to the post, without going over limit claps per user.
+// Returns the number of claps of the user and the new total of the post.
+func (m ClapModel) Add(postID, userID int64, n, limit int) (int, int64, error) {
+	query := `
+		INSERT INTO post_claps (post_id, user_id, count)
+		VALUES ($1, $2, LEAST($3::integer, $4::integer))
+		ON CONFLICT (post_id, user_id) DO UPDATE
+		SET count = LEAST(post_claps.count + $3, $4), updated_at = NOW()
+		WHERE post_claps.count < $4
+		RETURNING count
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, postID, userID, n, limit).Scan(&count)
+	if err != nil {
+		switch {
+		// the WHERE clause of the upsert didn't match, the user already has the maximum number of claps
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, 0, ErrClapLimitReached
+		case err.Error() == `pq: insert or update on table "post_claps" violates foreign key constraint "post_claps_post_id_fkey"`:
+			return 0, 0, ErrRecordNotFound
+		default:
+			return 0, 0, err
+		}
+	}
+
+	// queried separately, since a RETURNING clause doesn't see the changes made by the trigger
+	var total int64
+
+	err = m.DB.QueryRowContext(ctx, `SELECT claps FROM posts WHERE id = $1`, postID).Scan(&total)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, total, nil
+}
+
+// Remove takes back all claps of the user on the post
+func (m ClapModel) Remove(postID, userID int64) error {
+	query := `
+		DELETE FROM post_claps
+		WHERE post_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, postID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetForUser returns how many times the user clapped the post
+func (m ClapModel) GetForUser(postID, userID int64) (int, error) {
+	query := `
+		SELECT count
+		FROM post_claps
+		WHERE post_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, postID, userID).Scan(&count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
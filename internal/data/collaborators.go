@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+var ErrDuplicateCollaborator = errors.New("duplicate collaborator")
+
+const (
+	RoleCoAuthor = "co-author" // can edit and publish the post
+	RoleReviewer = "reviewer"  // can read the draft, but not edit it
+)
+
+// Collaborator is a user, other than the author, who was invited to work on a post
+type Collaborator struct {
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	Accepted  bool      `json:"accepted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CanEdit reports whether the collaborator is allowed to edit and publish the post
+func (c *Collaborator) CanEdit() bool {
+	return c.Accepted && c.Role == RoleCoAuthor
+}
+
+func ValidateCollaborator(v *validator.Validator, c *Collaborator) {
+	v.Check(c.Role != "", "role", "must be provided")
+	v.Check(validator.PermittedValue(c.Role, RoleCoAuthor, RoleReviewer), "role", "must be either co-author or reviewer")
+}
+
+type CollaboratorModel struct {
+	DB *sql.DB
+}
+
+func (m CollaboratorModel) Insert(c *Collaborator) error {
+	query := `
+		INSERT INTO post_collaborators (post_id, user_id, role, invited_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING accepted, created_at
+	`
+
+	args := []any{c.PostID, c.UserID, c.Role, c.InvitedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&c.Accepted, &c.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "post_collaborators_pkey"`:
+			return ErrDuplicateCollaborator
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CollaboratorModel) Get(postID, userID int64) (*Collaborator, error) {
+	query := `
+		SELECT pc.post_id, pc.user_id, u.username, pc.role, pc.invited_by, pc.accepted, pc.created_at
+		FROM post_collaborators pc
+		INNER JOIN users u ON u.id = pc.user_id
+		WHERE pc.post_id = $1 AND pc.user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c Collaborator
+
+	err := m.DB.QueryRowContext(ctx, query, postID, userID).Scan(
+		&c.PostID,
+		&c.UserID,
+		&c.Username,
+		&c.Role,
+		&c.InvitedBy,
+		&c.Accepted,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+func (m CollaboratorModel) GetAllForPost(postID int64) ([]*Collaborator, error) {
+	query := `
+		SELECT pc.post_id, pc.user_id, u.username, pc.role, pc.invited_by, pc.accepted, pc.created_at
+		FROM post_collaborators pc
+		INNER JOIN users u ON u.id = pc.user_id
+		WHERE pc.post_id = $1
+		ORDER BY pc.created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []*Collaborator{}
+
+	for rows.Next() {
+		var c Collaborator
+
+		err := rows.Scan(
+			&c.PostID,
+			&c.UserID,
+			&c.Username,
+			&c.Role,
+			&c.InvitedBy,
+			&c.Accepted,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		collaborators = append(collaborators, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// Accept marks a pending invitation as accepted by the invited user
+func (m CollaboratorModel) Accept(c *Collaborator) error {
+	query := `
+		UPDATE post_collaborators
+		SET accepted = TRUE
+		WHERE post_id = $1 AND user_id = $2 AND accepted = FALSE
+		RETURNING accepted
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, c.PostID, c.UserID).Scan(&c.Accepted)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CollaboratorModel) Delete(postID, userID int64) error {
+	query := `
+		DELETE FROM post_collaborators
+		WHERE post_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, postID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -4,19 +4,36 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	DeletedCommentBody = "[deleted]" // replaces the body of a deleted comment which is kept because it has replies
+	HiddenCommentBody  = "[hidden]"  // replaces the body of a hidden comment for the users who can't see it
 )
 
 type Comment struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    int64     `json:"user_id"`
-	PostID    int64     `json:"post_id"`
-	Version   int64     `json:"version"`
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     int64      `json:"user_id"` // 0 for a deleted comment
+	PostID     int64      `json:"post_id"`
+	ParentID   *int64     `json:"parent_id"` // the comment this one replies to, null for top level comments
+	Depth      int        `json:"depth"`     // 0 for top level comments, 1 for their replies, and so on
+	Path       []int64    `json:"path"`      // ids of the top level comment down to this one
+	ReplyCount int        `json:"reply_count"`
+	Deleted    bool       `json:"deleted,omitzero"`
+	Hidden     bool       `json:"hidden,omitzero"` // hidden by the author of the post
+	Held       bool       `json:"held,omitzero"`   // held for review as possible spam, only listed to its author and can't be edited until approved
+	Replies    []*Comment `json:"replies,omitempty"`
+	Mentions   []*Mention `json:"mentions,omitempty"` // the users mentioned in the body
+	Version    int64      `json:"version"`
+	ReactionSummary
 }
 
 func ValidateComment(v *validator.Validator, c *Comment) {
@@ -24,119 +41,416 @@ func ValidateComment(v *validator.Validator, c *Comment) {
 	v.Check(len(c.Body) >= 10, "comment", "must be atleast 10 characters long")
 }
 
+// FlattenComments returns the comments along with all of their replies
+func FlattenComments(comments []*Comment) []*Comment {
+	flat := []*Comment{}
+
+	for _, c := range comments {
+		flat = append(flat, c)
+		flat = append(flat, FlattenComments(c.Replies)...)
+	}
+
+	return flat
+}
+
+// RedactHidden replaces the bodies of the hidden comments, unless the viewer wrote them or is the
+// author of the post they're on
+func RedactHidden(comments []*Comment, viewerID, postAuthorID int64) {
+	if viewerID == postAuthorID {
+		return
+	}
+
+	for _, c := range comments {
+		if c.Hidden && c.UserID != viewerID {
+			c.Body = HiddenCommentBody
+			c.Mentions = nil
+		}
+	}
+}
+
+// CommentSortSafelist are the sorts of the top level comments of a post, the oldest first by default.
+// Replies are always listed oldest first.
+var CommentSortSafelist = []string{"created_at", "-created_at"}
+
+var commentSortColumns = map[string]string{
+	"created_at": "created_at",
+}
+
 type CommentModel struct {
 	DB *sql.DB
 }
 
-func (m CommentModel) Insert(comment *Comment) error {
+// Insert inserts a new comment. A comment held for review as possible spam is inserted along with its
+// hold, in the same transaction, and is only held when the hold isn't nil.
+func (m CommentModel) Insert(comment *Comment, hold *SpamHold) error {
+	comment.Held = hold != nil
+
 	query := `
-		INSERT INTO comments (body, user_id, post_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, user_id, post_id, version
+		INSERT INTO comments (body, user_id, post_id, parent_id, held_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN NOW() END)
+		RETURNING id, created_at, user_id, post_id, depth, path, version
 	`
 
 	args := []any{
 		comment.Body,
 		comment.UserID,
 		comment.PostID,
+		comment.ParentID,
+		comment.Held,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
 		&comment.UserID,
 		&comment.PostID,
+		&comment.Depth,
+		pq.Array(&comment.Path),
 		&comment.Version,
 	)
+	if err != nil {
+		return err
+	}
+
+	if hold != nil {
+		hold.TargetID = comment.ID
+
+		err = insertHold(ctx, tx, hold)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (m CommentModel) GetForPost(postID int64, filters *Filter) ([]*Comment, Metadata, error) {
-	query := `
-		SELECT count(*) over(), id, body, user_id, post_id, created_at, updated_at 
-		FROM comments
-		WHERE post_id = $1
-		ORDER BY id
-		LIMIT $2 OFFSET $3
-	`
+// commentColumns are the columns of a comment, in the order scanComment expects them
+const commentColumns = `
+	c.id, c.body, c.user_id, c.post_id, c.parent_id, c.depth, c.path, c.deleted_at IS NOT NULL, c.hidden_at IS NOT NULL,
+	c.held_at IS NOT NULL, (SELECT count(*) FROM comments r WHERE r.parent_id = c.id AND r.held_at IS NULL), c.created_at, c.updated_at, c.version`
+
+// scanComment scans the commentColumns, after the given destinations, into c
+func scanComment(row interface{ Scan(...any) error }, c *Comment, dest ...any) error {
+	dest = append(dest,
+		&c.ID,
+		&c.Body,
+		&c.UserID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Depth,
+		pq.Array(&c.Path),
+		&c.Deleted,
+		&c.Hidden,
+		&c.Held,
+		&c.ReplyCount,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Version,
+	)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	if c.Deleted {
+		c.Body = DeletedCommentBody
+		c.UserID = 0
+	}
+
+	return nil
+}
+
+// GetForPost returns a page of the top level comments of a post, each with the tree of its replies.
+// Comments held for review are left out, unless the viewer wrote them.
+func (m CommentModel) GetForPost(postID, viewerID int64, filters *Filter) ([]*Comment, Metadata, error) {
+	ks, err := filters.sortKeyset(commentSortColumns, "id")
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	page, err := filters.paginate(ks, 2)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM comments c
+		WHERE c.post_id = $1 AND c.parent_id IS NULL AND (c.held_at IS NULL OR c.user_id = $2) AND %s
+		ORDER BY %s
+		%s
+	`, page.Columns, commentColumns, page.Where, page.OrderBy, page.Limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, postID, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, append([]any{postID, viewerID}, page.Args...)...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
 	comments := []*Comment{}
+	keys := []string{}
 	totalRecords := 0
 
 	for rows.Next() {
-		var c Comment
-
-		err := rows.Scan(
-			&totalRecords,
-			&c.ID,
-			&c.Body,
-			&c.UserID,
-			&c.PostID,
-			&c.CreatedAt,
-			&c.UpdatedAt,
+		var (
+			c   Comment
+			key string
 		)
+
+		err := scanComment(rows, &c, &totalRecords, &key)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 		comments = append(comments, &c)
+		keys = append(keys, key)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	comments, metadata := finishPage(page, comments, keys, totalRecords)
 
-	return comments, metadata, err
+	err = m.loadReplies(ctx, postID, comments, viewerID)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return comments, metadata, nil
 }
 
-func (m CommentModel) Delete(commentID, userID, postID int64) error {
+// MaxLoadedReplies caps the number of replies loaded along with a page of comments. The nesting is
+// already capped when replying, this bounds threads which are wide rather than deep.
+const MaxLoadedReplies = 500
+
+// loadReplies fills in the replies of the top level comments, all the way down, up to MaxLoadedReplies.
+// The reply_count of a comment still counts all of its replies, so a cut off thread can be told apart.
+func (m CommentModel) loadReplies(ctx context.Context, postID int64, comments []*Comment, viewerID int64) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Comment)
+	ids := make([]int64, 0, len(comments))
+
+	for _, c := range comments {
+		byID[c.ID] = c
+		ids = append(ids, c.ID)
+	}
+
+	// ordered by path, every reply comes after its parent
 	query := `
-		DELETE FROM comments
-		WHERE id = $1 AND user_id = $2 AND post_id = $3
+		SELECT ` + commentColumns + `
+		FROM comments c
+		WHERE c.post_id = $1 AND c.path[1] = ANY($2) AND c.parent_id IS NOT NULL AND (c.held_at IS NULL OR c.user_id = $3)
+		ORDER BY c.path
+		LIMIT $4
 	`
 
+	rows, err := m.DB.QueryContext(ctx, query, postID, pq.Array(ids), viewerID, MaxLoadedReplies)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Comment
+
+		if err := scanComment(rows, &c); err != nil {
+			return err
+		}
+
+		// the replies to a comment which was left out are left out as well
+		if parent, ok := byID[*c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, &c)
+			byID[c.ID] = &c
+		}
+	}
+
+	return rows.Err()
+}
+
+// Delete deletes a comment. A comment with replies is kept as a tombstone instead, so that the thread
+// survives, and a tombstone whose last reply is deleted is deleted as well. When the comment is deleted
+// by a moderator rather than its author, the moderation action is logged along with it.
+func (m CommentModel) Delete(commentID, postID int64, moderation *ModerationAction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	res, err := m.DB.ExecContext(ctx, query, commentID, userID, postID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
+	defer tx.Rollback()
+
+	query := `
+		SELECT parent_id, EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		FROM comments c
+		WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	var (
+		parentID   *int64
+		hasReplies bool
+	)
+
+	err = tx.QueryRowContext(ctx, query, commentID, postID).Scan(&parentID, &hasReplies)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if moderation != nil {
+		err = settleModeration(ctx, tx, moderation)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasReplies {
+		err = m.tombstone(ctx, tx, commentID)
+	} else {
+		err = m.deleteWithTombstones(ctx, tx, commentID, parentID)
+	}
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	if moderation != nil {
+		err = insertModerationAction(ctx, tx, moderation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// tombstone empties a comment which has replies, keeping it in their thread
+func (m CommentModel) tombstone(ctx context.Context, tx *sql.Tx, commentID int64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE comments SET body = '', deleted_at = NOW() WHERE id = $1`, commentID)
+	if err != nil {
+		return err
+	}
+
+	// the reactions, mentions and pending hold are only removed by triggers when the comment itself is deleted
+	_, err = tx.ExecContext(ctx, `DELETE FROM reactions WHERE target_type = 'comment' AND target_id = $1`, commentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM mentions WHERE target_type = 'comment' AND target_id = $1`, commentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM spam_holds WHERE target_type = 'comment' AND target_id = $1 AND status = 'held'`, commentID)
+	return err
+}
+
+// deleteWithTombstones deletes a comment without replies, then goes up the thread removing the
+// tombstones which were only kept for it
+func (m CommentModel) deleteWithTombstones(ctx context.Context, tx *sql.Tx, commentID int64, parentID *int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, commentID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM comments c
+		WHERE id = $1 AND deleted_at IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		RETURNING parent_id
+	`
+
+	for parentID != nil {
+		err = tx.QueryRowContext(ctx, query, *parentID).Scan(&parentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (m CommentModel) Update(comment *Comment) error {
+// SetHidden hides or unhides a comment, and logs the moderation action along with it
+func (m CommentModel) SetHidden(comment *Comment, hidden bool, moderation *ModerationAction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = settleModeration(ctx, tx, moderation)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE comments
+		SET hidden_at = CASE WHEN $1 THEN COALESCE(hidden_at, NOW()) END
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING hidden_at IS NOT NULL
+	`
+
+	err = tx.QueryRowContext(ctx, query, hidden, comment.ID).Scan(&comment.Hidden)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = insertModerationAction(ctx, tx, moderation)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update saves the edited body of a comment. An edit held for review as possible spam is saved along
+// with its hold, in the same transaction, and the comment is only held when the hold isn't nil.
+func (m CommentModel) Update(comment *Comment, hold *SpamHold) error {
+	comment.Held = hold != nil
+
 	query := `
 		UPDATE comments
 		SET 
 		body = $1,
+		held_at = CASE WHEN $6 THEN NOW() ELSE held_at END,
 		updated_at = now(),
 		version = version + 1
 		WHERE id = $2 
 		AND user_id = $3 
 		AND post_id = $4 
 		AND version = $5
+		AND deleted_at IS NULL
 		RETURNING updated_at, version
 	`
 
@@ -146,12 +460,19 @@ func (m CommentModel) Update(comment *Comment) error {
 		comment.UserID,
 		comment.PostID,
 		comment.Version,
+		comment.Held,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&comment.UpdatedAt,
 		&comment.Version,
 	)
@@ -165,14 +486,23 @@ func (m CommentModel) Update(comment *Comment) error {
 		}
 	}
 
-	return nil
+	if hold != nil {
+		hold.TargetID = comment.ID
+
+		err = insertHold(ctx, tx, hold)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (m CommentModel) Get(commentID int64) (*Comment, error) {
 	query := `
-		SELECT id, body, user_id, post_id, created_at, updated_at, version
-		FROM comments
-		WHERE id = $1
+		SELECT ` + commentColumns + `
+		FROM comments c
+		WHERE c.id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -180,15 +510,7 @@ func (m CommentModel) Get(commentID int64) (*Comment, error) {
 
 	var comment Comment
 
-	err := m.DB.QueryRowContext(ctx, query, commentID).Scan(
-		&comment.ID,
-		&comment.Body,
-		&comment.UserID,
-		&comment.PostID,
-		&comment.CreatedAt,
-		&comment.UpdatedAt,
-		&comment.Version,
-	)
+	err := scanComment(m.DB.QueryRowContext(ctx, query, commentID), &comment)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
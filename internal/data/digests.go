@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DigestRecipient is a user who is due a digest of the new posts in the tags they follow
+type DigestRecipient struct {
+	UserID   int64
+	Username string
+	Email    string
+	Since    time.Time // posts published after this go into the digest
+}
+
+type DigestModel struct {
+	DB *sql.DB
+}
+
+// GetDue returns the activated users who aren't suspended, follow at least one tag, didn't
+// unsubscribe, and haven't received a digest within interval
+func (m DigestModel) GetDue(interval time.Duration) ([]*DigestRecipient, error) {
+	query := `
+		SELECT u.id, u.username, u.email, coalesce(d.last_sent_at, NOW() - make_interval(secs => $1))
+		FROM users u
+		LEFT JOIN digest_subscriptions d ON d.user_id = u.id
+		WHERE u.activated
+			AND u.suspended_at IS NULL
+			AND d.unsubscribed_at IS NULL
+			AND (d.last_sent_at IS NULL OR d.last_sent_at <= NOW() - make_interval(secs => $1))
+			AND EXISTS (SELECT 1 FROM tag_follows f WHERE f.user_id = u.id)
+		ORDER BY u.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, interval.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*DigestRecipient{}
+
+	for rows.Next() {
+		var r DigestRecipient
+
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email, &r.Since); err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// GetPosts returns the top posts published after since in the tags the user follows, ranked by
+// their trending score and then by claps. The user's own posts are left out.
+func (m DigestModel) GetPosts(userID int64, since time.Time, limit int) ([]*Post, error) {
+	query := `
+		SELECT p.id, p.slug, p.title, p.subtitle, p.published_at, p.tags, p.claps, p.reading_time, p.excerpt
+		FROM posts p
+		LEFT JOIN post_scores ps ON ps.post_id = p.id
+		WHERE p.status = 'published'
+			AND p.published_at > $2
+			AND p.user_id <> $1
+			AND p.tags && ARRAY(
+				SELECT t.slug
+				FROM tags t
+				INNER JOIN tag_follows f ON f.tag_id = t.id
+				WHERE f.user_id = $1
+			)
+		ORDER BY coalesce(ps.score, 0) DESC, p.claps DESC, p.published_at DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+
+	for rows.Next() {
+		var post Post
+
+		err := rows.Scan(
+			&post.ID,
+			&post.Slug,
+			&post.Title,
+			&post.Subtitle,
+			&post.PublishedAt,
+			pq.Array(&post.Tags),
+			&post.Claps,
+			&post.ReadingTime,
+			&post.Excerpt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// MarkSent records that the user was sent a digest, or that there was nothing to send, at the given time
+func (m DigestModel) MarkSent(userID int64, at time.Time) error {
+	query := `
+		INSERT INTO digest_subscriptions (user_id, last_sent_at)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_sent_at = EXCLUDED.last_sent_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, at)
+	return err
+}
+
+// SetSubscribed turns the digest emails of the user on or off
+func (m DigestModel) SetSubscribed(userID int64, subscribed bool) error {
+	query := `
+		INSERT INTO digest_subscriptions (user_id, unsubscribed_at)
+		VALUES ($1, CASE WHEN $2 THEN NULL ELSE NOW() END)
+		ON CONFLICT (user_id) DO UPDATE
+		SET unsubscribed_at = EXCLUDED.unsubscribed_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, subscribed)
+	return err
+}
+
+// IsSubscribed reports whether the user gets digest emails
+func (m DigestModel) IsSubscribed(userID int64) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM digest_subscriptions
+			WHERE user_id = $1 AND unsubscribed_at IS NOT NULL
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var subscribed bool
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&subscribed)
+	return subscribed, err
+}
@@ -1,10 +1,44 @@
 package data
 
-import "github.com/Infamous003/go-blog/internal/validator"
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// ErrInvalidCursor is returned by list queries for a cursor which came from a list in another order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSort is returned by list queries for a sort which isn't in the safelist
+var ErrInvalidSort = errors.New("invalid sort")
+
+// cursorSecret signs the cursors, so that clients can't forge them
+var cursorSecret []byte
+
+// SetCursorSecret sets the secret the pagination cursors are signed with. Cursors signed with another
+// secret are rejected, so they stop working when it changes.
+func SetCursorSecret(secret []byte) {
+	cursorSecret = secret
+}
+
+// Filter paginates a list. Pages are either numbered, or start after or end before the item of a
+// cursor from the metadata of another page. Cursor pages don't shift when items are added, and are
+// just as fast deep into the list, but don't tell the total number of items.
 type Filter struct {
-	Page     int
-	PageSize int
+	Page         int
+	PageSize     int
+	Sort         string   // a field to sort by, descending when prefixed with -
+	SortSafelist []string // the sorts the list supports, empty when it has a fixed order
+	After        string   // cursor of the item the page starts after
+	Before       string   // cursor of the item the page ends before
 }
 
 func ValidateFilters(v *validator.Validator, f Filter) {
@@ -13,6 +47,22 @@ func ValidateFilters(v *validator.Validator, f Filter) {
 
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	if len(f.SortSafelist) > 0 {
+		v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "must be one of "+strings.Join(f.SortSafelist, ", "))
+	}
+
+	v.Check(f.After == "" || f.Before == "", "before", "must not be used together with after")
+
+	if f.After != "" {
+		_, err := decodeCursor(f.After)
+		v.Check(err == nil, "after", "must be a cursor from the metadata of a page")
+	}
+
+	if f.Before != "" {
+		_, err := decodeCursor(f.Before)
+		v.Check(err == nil, "before", "must be a cursor from the metadata of a page")
+	}
 }
 
 func (f Filter) limit() int {
@@ -23,12 +73,28 @@ func (f Filter) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// sortKeyset returns the keyset of the sort of the filter. The column to sort by is looked up in
+// columns by the name of the sort without its - prefix, and ties are broken by idColumn in the same
+// direction, so that the order is always the same. The sort is expected to be validated by
+// ValidateFilters first, one which isn't in the safelist never reaches the query, ErrInvalidSort is
+// returned instead.
+func (f Filter) sortKeyset(columns map[string]string, idColumn string) (keyset, error) {
+	column, ok := columns[strings.TrimPrefix(f.Sort, "-")]
+	if !ok || !slices.Contains(f.SortSafelist, f.Sort) {
+		return keyset{}, ErrInvalidSort
+	}
+
+	return keyset{name: f.Sort, columns: []string{column, idColumn}, desc: strings.HasPrefix(f.Sort, "-")}, nil
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitzero"`
-	PageSize     int `json:"page_size,omitzero"`
-	FirstPage    int `json:"first_page,omitzero"`
-	LastPage     int `json:"last_page,omitzero"`
-	TotalRecords int `json:"total_records,omitzero"`
+	CurrentPage  int    `json:"current_page,omitzero"`
+	PageSize     int    `json:"page_size,omitzero"`
+	FirstPage    int    `json:"first_page,omitzero"`
+	LastPage     int    `json:"last_page,omitzero"`
+	TotalRecords int    `json:"total_records,omitzero"`
+	NextCursor   string `json:"next_cursor,omitzero"` // pass as after for the next page
+	PrevCursor   string `json:"prev_cursor,omitzero"` // pass as before for the previous page
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -44,3 +110,223 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// cursor is the position of an item in a list, made of the values of the columns the list is ordered by
+type cursor struct {
+	Order string          `json:"o"` // the keyset the list was ordered by
+	Keys  json.RawMessage `json:"k"`
+}
+
+// encodeCursor returns the keys of an item, as a JSON array, as an opaque signed cursor
+func encodeCursor(order, keys string) string {
+	payload, _ := json.Marshal(cursor{Order: order, Keys: json.RawMessage(keys)})
+
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// keyset is the order of a list query, for cursor pagination. The columns are compared together as
+// a row, so they're all sorted in the same direction, and the last one has to be unique, e.g. the id.
+type keyset struct {
+	name    string // identifies the order in cursors, so that they aren't used with another order
+	columns []string
+	desc    bool
+
+	// uncounted lists don't get a total count, which would make the database read every row instead
+	// of only one page of them from an index. Their numbered pages only tell whether there's a next one.
+	uncounted bool
+}
+
+// pagination holds the parts of a list query which depend on how it's paginated. They're added to
+// the query with fmt.Sprintf, and their arguments come after the other arguments of the query.
+type pagination struct {
+	filter  Filter
+	keyset  keyset
+	reverse bool // the rows are fetched in reverse, to page backwards from a before cursor
+
+	Columns string // the total count and the cursor keys of each row, selected first
+	Where   string // condition limiting the rows to the ones after or before the cursor
+	OrderBy string
+	Limit   string
+	Args    []any
+}
+
+// paginate returns the parts of a list query ordered by ks for the filter, whose placeholders start
+// after the first nargs arguments of the query
+func (f Filter) paginate(ks keyset, nargs int) (*pagination, error) {
+	p := &pagination{filter: f, keyset: ks}
+
+	keys := fmt.Sprintf("json_build_array(%s)::text", strings.Join(ks.columns, ", "))
+	placeholder := func() string {
+		return fmt.Sprintf("$%d", nargs+len(p.Args))
+	}
+
+	if f.After == "" && f.Before == "" {
+		p.Columns = "count(*) OVER(), " + keys
+		p.Where = "TRUE"
+		p.OrderBy = orderBy(ks.columns, ks.desc)
+
+		limit := f.limit()
+		if ks.uncounted {
+			p.Columns = "0, " + keys
+			limit++ // one more row than the page size tells whether there's a next page
+		}
+
+		p.Args = append(p.Args, limit)
+		p.Limit = "LIMIT " + placeholder()
+		p.Args = append(p.Args, f.offset())
+		p.Limit += " OFFSET " + placeholder()
+
+		return p, nil
+	}
+
+	encoded := f.After
+	if encoded == "" {
+		encoded = f.Before
+		p.reverse = true
+	}
+
+	c, err := decodeCursor(encoded)
+	if err != nil || c.Order != ks.name {
+		return nil, ErrInvalidCursor
+	}
+
+	// the keys are passed as text, postgres converts them to the types of their columns
+	decoder := json.NewDecoder(bytes.NewReader(c.Keys))
+	decoder.UseNumber()
+
+	var values []any
+	if err := decoder.Decode(&values); err != nil || len(values) != len(ks.columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	placeholders := make([]string, 0, len(values))
+	for _, value := range values {
+		p.Args = append(p.Args, fmt.Sprint(value))
+		placeholders = append(placeholders, placeholder())
+	}
+
+	// going forward in a descending list, or backwards in an ascending one, means smaller keys
+	op := ">"
+	if ks.desc != p.reverse {
+		op = "<"
+	}
+
+	p.Columns = "0, " + keys
+	p.Where = fmt.Sprintf("(%s) %s (%s)", strings.Join(ks.columns, ", "), op, strings.Join(placeholders, ", "))
+	p.OrderBy = orderBy(ks.columns, ks.desc != p.reverse)
+
+	// one more row than the page size tells whether there's another page after this one
+	p.Args = append(p.Args, f.limit()+1)
+	p.Limit = "LIMIT " + placeholder()
+
+	return p, nil
+}
+
+func orderBy(columns []string, desc bool) string {
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+
+	return strings.Join(columns, direction+", ") + direction
+}
+
+// finishPage returns the items of a page in order, given the items and their cursor keys as fetched
+// by a query paginated with p, along with its metadata
+func finishPage[T any](p *pagination, items []T, keys []string, totalRecords int) ([]T, Metadata) {
+	f := p.filter
+
+	if f.After == "" && f.Before == "" && p.keyset.uncounted {
+		more := len(items) > f.PageSize
+		if more {
+			items, keys = items[:f.PageSize], keys[:f.PageSize]
+		}
+
+		metadata := Metadata{CurrentPage: f.Page, PageSize: f.PageSize, FirstPage: 1}
+
+		if len(items) > 0 {
+			if more {
+				metadata.NextCursor = encodeCursor(p.keyset.name, keys[len(keys)-1])
+			}
+			if f.Page > 1 {
+				metadata.PrevCursor = encodeCursor(p.keyset.name, keys[0])
+			}
+		}
+
+		return items, metadata
+	}
+
+	if f.After == "" && f.Before == "" {
+		metadata := calculateMetadata(totalRecords, f.Page, f.PageSize)
+
+		if len(items) > 0 {
+			if f.Page < metadata.LastPage {
+				metadata.NextCursor = encodeCursor(p.keyset.name, keys[len(keys)-1])
+			}
+			if f.Page > 1 {
+				metadata.PrevCursor = encodeCursor(p.keyset.name, keys[0])
+			}
+		}
+
+		return items, metadata
+	}
+
+	more := len(items) > f.PageSize
+	if more {
+		items, keys = items[:f.PageSize], keys[:f.PageSize]
+	}
+
+	if p.reverse {
+		slices.Reverse(items)
+		slices.Reverse(keys)
+	}
+
+	metadata := Metadata{PageSize: f.PageSize}
+
+	if len(items) > 0 {
+		// there's always a page on the side the cursor came from
+		if more || p.reverse {
+			metadata.NextCursor = encodeCursor(p.keyset.name, keys[len(keys)-1])
+		}
+		if more || !p.reverse {
+			metadata.PrevCursor = encodeCursor(p.keyset.name, keys[0])
+		}
+	}
+
+	return items, metadata
+}
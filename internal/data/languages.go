@@ -0,0 +1,99 @@
+package data
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DefaultLanguage is the language of posts whose language isn't given and can't be detected
+const DefaultLanguage = "en"
+
+// searchConfigs are the languages posts can be written in, by ISO 639-1 code, with the PostgreSQL text
+// search configuration used to stem them. The post_search_config SQL function maps them the same way.
+var searchConfigs = map[string]string{
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"it": "italian",
+	"nl": "dutch",
+	"pt": "portuguese",
+}
+
+// Languages returns the codes of the languages posts can be written in
+func Languages() []string {
+	return slices.Sorted(maps.Keys(searchConfigs))
+}
+
+func ValidLanguage(code string) bool {
+	_, ok := searchConfigs[code]
+	return ok
+}
+
+// languageStopwords are some of the most common words of each language, used to tell them apart.
+// Words shared by several of the languages are left out. The backfill of migration 000023 detected
+// the language of the existing posts with the same lists.
+var languageStopwords = map[string][]string{
+	"de": {"der", "und", "nicht", "ist", "ich", "mit", "sich", "auf", "für", "auch", "wir", "eine", "wird", "zu", "dem"},
+	"en": {"the", "and", "of", "to", "with", "that", "this", "for", "are", "was", "it", "you", "not", "be", "is"},
+	"es": {"el", "los", "las", "y", "es", "por", "pero", "más", "está", "del", "muy", "también", "cuando", "hay", "sus"},
+	"fr": {"les", "et", "est", "une", "pour", "pas", "dans", "qui", "sur", "avec", "ce", "sont", "au", "des", "nous"},
+	"it": {"gli", "è", "per", "non", "che", "sono", "della", "nel", "alla", "questo", "anche", "di", "dei", "degli", "molto"},
+	"nl": {"het", "een", "niet", "van", "dat", "zijn", "voor", "met", "ook", "wordt", "maar", "bij", "naar", "hij", "wij"},
+	"pt": {"uma", "não", "com", "são", "mais", "pelo", "pela", "ao", "muito", "também", "isso", "você", "seu", "foi", "ele"},
+}
+
+// DetectLanguage guesses the language of a text by counting the common words of each language in
+// it. ok is false when there are fewer than minHits of them, or when two languages are tied, which
+// is usually the case for short texts like searches.
+func DetectLanguage(text string, minHits int) (code string, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	hits := make(map[string]int, len(languageStopwords))
+
+	for _, word := range words {
+		for lang, stopwords := range languageStopwords {
+			if slices.Contains(stopwords, word) {
+				hits[lang]++
+			}
+		}
+	}
+
+	best, tied := "", false
+
+	for _, lang := range Languages() {
+		switch {
+		case best == "" || hits[lang] > hits[best]:
+			best, tied = lang, false
+		case hits[lang] == hits[best]:
+			tied = true
+		}
+	}
+
+	if hits[best] < minHits || tied {
+		return "", false
+	}
+
+	return best, true
+}
+
+// matchSearch returns a condition matching posts against the search in the given placeholder, with
+// the text search configuration of the language of each post, e.g. for tsqueryFunc websearch_to_tsquery.
+// It's spelled out per language, since the search_vector index can only be used with a constant query.
+func matchSearch(tsqueryFunc, placeholder string) string {
+	conditions := make([]string, 0, len(searchConfigs))
+
+	for _, lang := range Languages() {
+		conditions = append(conditions, fmt.Sprintf(
+			"(language = '%s' AND search_vector @@ %s('%s', %s))",
+			lang, tsqueryFunc, searchConfigs[lang], placeholder,
+		))
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
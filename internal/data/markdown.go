@@ -0,0 +1,80 @@
+package data
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	wordsPerMinute = 238 // average silent reading speed of an adult
+	excerptLength  = 200 // maximum length of an excerpt, in characters
+)
+
+// Replacements applied in order to turn markdown into plain text. The order matters,
+// e.g. images have to be removed before links, since ![alt](src) contains a link.
+var markdownReplacements = []struct {
+	rx   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile("(?s)```.*?```"), " "},           // fenced code blocks
+	{regexp.MustCompile(`<[^>]+>`), " "},                 // html tags
+	{regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`), " "},    // images
+	{regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`), "$1"},  // links, keeping the text
+	{regexp.MustCompile("`([^`]*)`"), "$1"},              // inline code
+	{regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`), ""},    // headings
+	{regexp.MustCompile(`(?m)^\s{0,3}>\s?`), ""},         // blockquotes
+	{regexp.MustCompile(`(?m)^\s*([-*+]|\d+\.)\s+`), ""}, // list items
+	{regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`), ""},  // horizontal rules
+	{regexp.MustCompile(`\*\*([^*]+)\*\*`), "$1"},        // bold
+	{regexp.MustCompile(`__([^_]+)__`), "$1"},            // bold
+	{regexp.MustCompile(`\*([^*]+)\*`), "$1"},            // italic
+	{regexp.MustCompile(`\b_([^_]+)_\b`), "$1"},          // italic
+	{regexp.MustCompile(`~~([^~]+)~~`), "$1"},            // strikethrough
+}
+
+// stripMarkdown returns the plain text of a markdown document
+func stripMarkdown(md string) string {
+	for _, r := range markdownReplacements {
+		md = r.rx.ReplaceAllString(md, r.repl)
+	}
+
+	return md
+}
+
+// excerpt joins words until the text would get longer than limit characters,
+// so that the excerpt never ends in the middle of a word. A cut excerpt ends in
+// an ellipsis, which counts towards the limit.
+func excerpt(words []string, limit int) string {
+	if text := strings.Join(words, " "); utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	limit-- // room for the ellipsis
+
+	var sb strings.Builder
+	length := 0
+
+	for i, word := range words {
+		n := utf8.RuneCountInString(word)
+		if i > 0 {
+			n++ // the space in between
+		}
+
+		if length+n > limit {
+			// a single word longer than the limit is cut, since there is no other boundary
+			if i == 0 {
+				return string([]rune(word)[:limit]) + "…"
+			}
+			break
+		}
+
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(word)
+		length += n
+	}
+
+	return sb.String() + "…"
+}
@@ -0,0 +1,310 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Content types which can be uploaded, mapped to the file extension they are stored with
+var ImageContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+const (
+	MediaPending = "pending" // uploaded, waiting for the image pipeline
+	MediaReady   = "ready"   // variants were generated
+	MediaFailed  = "failed"  // the image couldn't be processed, only the private original exists
+)
+
+// Media is a file uploaded by a user, e.g. the cover image of a post
+type Media struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at,omitzero"`
+	UserID      int64           `json:"user_id,omitzero"`
+	Key         string          `json:"-"`            // where the file is in the storage
+	URL         string          `json:"url,omitzero"` // only set once the image is processed
+	Filename    string          `json:"filename,omitzero"`
+	ContentType string          `json:"content_type"`
+	Size        int64           `json:"size,omitzero"`
+	Width       int             `json:"width,omitzero"`
+	Height      int             `json:"height,omitzero"`
+	Status      string          `json:"status"`
+	Variants    []*MediaVariant `json:"variants,omitempty"`
+	Srcset      string          `json:"srcset,omitzero"` // ready to be used in the srcset attribute of an <img>
+}
+
+// MediaVariant is a resized version of an uploaded image, e.g. a thumbnail
+type MediaVariant struct {
+	MediaID     int64  `json:"-"`
+	Name        string `json:"name"`
+	Key         string `json:"-"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+type MediaModel struct {
+	DB *sql.DB
+}
+
+func (m MediaModel) Insert(media *Media) error {
+	query := `
+		INSERT INTO media (user_id, storage_key, filename, content_type, size)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, status
+	`
+
+	args := []any{media.UserID, media.Key, media.Filename, media.ContentType, media.Size}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&media.ID, &media.CreatedAt, &media.Status)
+}
+
+func (m MediaModel) Get(id int64) (*Media, error) {
+	media, err := m.GetMany([]int64{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(media) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return media[0], nil
+}
+
+// IsPublishedCover reports whether the media is the cover image of a published post
+func (m MediaModel) IsPublishedCover(id int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM posts WHERE cover_image_id = $1 AND status = 'published')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var published bool
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&published)
+	return published, err
+}
+
+// GetMany fetches the media with the given ids along with their variants
+func (m MediaModel) GetMany(ids []int64) ([]*Media, error) {
+	query := `
+		SELECT id, created_at, user_id, storage_key, filename, content_type, size, width, height, status
+		FROM media
+		WHERE id = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []*Media{}
+	byID := make(map[int64]*Media)
+
+	for rows.Next() {
+		var md Media
+
+		err := rows.Scan(
+			&md.ID,
+			&md.CreatedAt,
+			&md.UserID,
+			&md.Key,
+			&md.Filename,
+			&md.ContentType,
+			&md.Size,
+			&md.Width,
+			&md.Height,
+			&md.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		media = append(media, &md)
+		byID[md.ID] = &md
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT media_id, name, storage_key, content_type, width, height, size
+		FROM media_variants
+		WHERE media_id = ANY($1)
+		ORDER BY media_id, width
+	`
+
+	rows, err = m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v MediaVariant
+
+		err := rows.Scan(&v.MediaID, &v.Name, &v.Key, &v.ContentType, &v.Width, &v.Height, &v.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		if md, ok := byID[v.MediaID]; ok {
+			md.Variants = append(md.Variants, &v)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// GetPendingIDs returns the ids of the media that haven't been processed yet
+func (m MediaModel) GetPendingIDs() ([]int64, error) {
+	query := `
+		SELECT id
+		FROM media
+		WHERE status = 'pending'
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (m MediaModel) SetStatus(id int64, status string) error {
+	query := `
+		UPDATE media
+		SET status = $1
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, status, id)
+	return err
+}
+
+// SetProcessed saves the results of the image pipeline, i.e. the (possibly re-encoded) original
+// and its variants, and marks the media as ready
+func (m MediaModel) SetProcessed(media *Media, variants []*MediaVariant) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE media
+		SET storage_key = $1, content_type = $2, size = $3, width = $4, height = $5, status = 'ready'
+		WHERE id = $6
+		RETURNING status
+	`
+
+	args := []any{media.Key, media.ContentType, media.Size, media.Width, media.Height, media.ID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&media.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM media_variants WHERE media_id = $1`, media.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO media_variants (media_id, name, storage_key, content_type, width, height, size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	for _, v := range variants {
+		_, err = tx.ExecContext(ctx, query, media.ID, v.Name, v.Key, v.ContentType, v.Width, v.Height, v.Size)
+		if err != nil {
+			return err
+		}
+	}
+
+	media.Variants = variants
+
+	return tx.Commit()
+}
+
+func (m MediaModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM media
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Types of the things users can be mentioned in
+const (
+	MentionTargetPost    = "post"
+	MentionTargetComment = "comment"
+)
+
+// maxMentions caps the users a single post or comment can mention, so that it can't be used to
+// notify everyone at once
+const maxMentions = 20
+
+var (
+	// a mention starts at the beginning of the text or after anything that can't be part of a word,
+	// so that the @ in an email address isn't one
+	mentionRX = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@/-])@([\p{L}\p{N}_.-]+)`)
+
+	// code can contain @ for other reasons, like decorators, so it's removed before looking for mentions
+	mentionCodeRX = regexp.MustCompile("(?s)```.*?```|`[^`]*`")
+)
+
+// Mention is a user mentioned in a post or comment, for clients to link to their profile
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// MentionNotice is a user to let know that they were mentioned
+type MentionNotice struct {
+	UserID   int64
+	Username string
+	Email    string
+}
+
+// ParseMentions returns the distinct usernames mentioned with @username in a markdown text, outside
+// of code. Only usernames made of letters, digits, underscores, dots and hyphens can be mentioned, and
+// a trailing dot or hyphen is taken as punctuation, as in "thanks @someone."
+func ParseMentions(text string) []string {
+	text = mentionCodeRX.ReplaceAllString(text, " ")
+
+	usernames := []string{}
+
+	for _, match := range mentionRX.FindAllStringSubmatch(text, -1) {
+		username := strings.TrimRight(match[1], ".-")
+
+		if len(username) < 8 || len(username) > 32 {
+			continue // too short or too long to be a username
+		}
+
+		if !slices.Contains(usernames, username) {
+			usernames = append(usernames, username)
+		}
+
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+type MentionModel struct {
+	DB *sql.DB
+}
+
+// Sync stores the mentions of a post or comment, replacing the ones from before it was edited. The
+// usernames which aren't activated users, and users who blocked the author, are skipped. The users
+// are notified separately, with Notify.
+func (m MentionModel) Sync(targetType string, targetID, authorID int64, usernames []string) ([]*Mention, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT u.id, u.username, u.email
+		FROM users u
+		WHERE u.username = ANY($1) AND u.activated
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE b.blocker_id = u.id AND b.blocked_id = $2
+			)
+	`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(usernames), authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byUsername := make(map[string]*MentionNotice)
+	ids := []int64{}
+
+	for rows.Next() {
+		var user MentionNotice
+
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Email); err != nil {
+			return nil, err
+		}
+
+		byUsername[user.Username] = &user
+		ids = append(ids, user.UserID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		DELETE FROM mentions
+		WHERE target_type = $1 AND target_id = $2 AND NOT (user_id = ANY($3))
+	`
+
+	_, err = tx.ExecContext(ctx, query, targetType, targetID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO mentions (target_type, target_id, user_id, author_id)
+		SELECT $1, $2, unnest($3::bigint[]), $4
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, query, targetType, targetID, pq.Array(ids), authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// in the order they were mentioned
+	mentions := []*Mention{}
+	for _, username := range usernames {
+		if user, ok := byUsername[username]; ok {
+			mentions = append(mentions, &Mention{UserID: user.UserID, Username: user.Username})
+		}
+	}
+
+	return mentions, nil
+}
+
+// Notify records that the users mentioned in a post or comment were notified, and returns the ones
+// who never were before, to be emailed. The author, and users who blocked the author since, are left
+// out. Since the notifications outlive the edits, a mention removed and added back is only notified once.
+func (m MentionModel) Notify(targetType string, targetID int64) ([]*MentionNotice, error) {
+	query := `
+		WITH notified AS (
+			INSERT INTO mention_notifications (target_type, target_id, user_id)
+			SELECT m.target_type, m.target_id, m.user_id
+			FROM mentions m
+			WHERE m.target_type = $1 AND m.target_id = $2 AND m.user_id <> m.author_id
+				AND NOT EXISTS (
+					SELECT 1 FROM user_blocks b
+					WHERE b.blocker_id = m.user_id AND b.blocked_id = m.author_id
+				)
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.email
+		FROM notified n
+		INNER JOIN users u ON u.id = n.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notices := []*MentionNotice{}
+
+	for rows.Next() {
+		var notice MentionNotice
+
+		if err := rows.Scan(&notice.UserID, &notice.Username, &notice.Email); err != nil {
+			return nil, err
+		}
+
+		notices = append(notices, &notice)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notices, nil
+}
+
+// Load fills in the mentions of targets, which are keyed by their ids
+func (m MentionModel) Load(targetType string, targets map[int64]*[]*Mention) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+
+	query := `
+		SELECT m.target_id, u.id, u.username
+		FROM mentions m
+		INNER JOIN users u ON u.id = m.user_id
+		WHERE m.target_type = $1 AND m.target_id = ANY($2)
+		ORDER BY m.target_id, u.username
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetType, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id      int64
+			mention Mention
+		)
+
+		if err := rows.Scan(&id, &mention.UserID, &mention.Username); err != nil {
+			return err
+		}
+
+		target, ok := targets[id]
+		if !ok {
+			continue
+		}
+
+		*target = append(*target, &mention)
+	}
+
+	return rows.Err()
+}
@@ -13,18 +13,52 @@ var (
 
 // A container representing all the models
 type Models struct {
-	Posts    PostModel
-	Users    UserModel
-	Comments CommentModel
-	Tokens   TokenModel
+	Posts         PostModel
+	Users         UserModel
+	Comments      CommentModel
+	Tokens        TokenModel
+	Series        SeriesModel
+	Collaborators CollaboratorModel
+	Permissions   PermissionModel
+	Reviews       ReviewModel
+	Media         MediaModel
+	Claps         ClapModel
+	ReadingLists  ReadingListModel
+	Reactions     ReactionModel
+	Views         ViewModel
+	Tags          TagModel
+	Digests       DigestModel
+	Search        SearchModel
+	Moderation    ModerationModel
+	Reports       ReportModel
+	Spam          SpamModel
+	Mentions      MentionModel
+	Blocks        BlockModel
 }
 
 // Returns a Models struct which contains all the models initialized with a DB
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Posts:    PostModel{DB: db},
-		Users:    UserModel{DB: db},
-		Comments: CommentModel{DB: db},
-		Tokens:   TokenModel{DB: db},
+		Posts:         PostModel{DB: db},
+		Users:         UserModel{DB: db},
+		Comments:      CommentModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Series:        SeriesModel{DB: db},
+		Collaborators: CollaboratorModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Reviews:       ReviewModel{DB: db},
+		Media:         MediaModel{DB: db},
+		Claps:         ClapModel{DB: db},
+		ReadingLists:  ReadingListModel{DB: db},
+		Reactions:     ReactionModel{DB: db},
+		Views:         ViewModel{DB: db},
+		Tags:          TagModel{DB: db},
+		Digests:       DigestModel{DB: db},
+		Search:        SearchModel{DB: db},
+		Moderation:    ModerationModel{DB: db},
+		Reports:       ReportModel{DB: db},
+		Spam:          SpamModel{DB: db},
+		Mentions:      MentionModel{DB: db},
+		Blocks:        BlockModel{DB: db},
 	}
 }
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+// Comment modes of a post
+const (
+	CommentsOpen     = "open"
+	CommentsLocked   = "locked"   // the comments stay visible, but no new ones can be added
+	CommentsDisabled = "disabled" // the comments are only visible to the author of the post
+)
+
+// Moderation actions, of the author of a post on its comments, and of moderators on reported content
+const (
+	ActionHideComment     = "hide_comment"
+	ActionUnhideComment   = "unhide_comment"
+	ActionDeleteComment   = "delete_comment"
+	ActionOpenComments    = "open_comments"
+	ActionLockComments    = "lock_comments"
+	ActionDisableComments = "disable_comments"
+	ActionHidePost        = "hide_post"
+	ActionDeletePost      = "delete_post"
+	ActionSuspendUser     = "suspend_user"
+)
+
+// commentsModeActions are the actions logged when the comments of a post are switched to a mode
+var commentsModeActions = map[string]string{
+	CommentsOpen:     ActionOpenComments,
+	CommentsLocked:   ActionLockComments,
+	CommentsDisabled: ActionDisableComments,
+}
+
+// ModerationAction records a moderator acting on a post, one of its comments, or a user
+type ModerationAction struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ModeratorID int64     `json:"moderator_id"`
+	Moderator   string    `json:"moderator"`
+	PostID      *int64    `json:"post_id,omitempty"`
+	CommentID   *int64    `json:"comment_id,omitempty"`
+	UserID      *int64    `json:"user_id,omitempty"`   // the suspended user
+	ReportID    *int64    `json:"report_id,omitempty"` // the report the action was taken on
+	Action      string    `json:"action"`
+	Reason      string    `json:"reason,omitzero"`
+
+	Resolves *ReportResolution `json:"-"` // the report resolved along with the action, if any
+	Rejects  *SpamHold         `json:"-"` // the held content rejected as spam by the action, if any
+}
+
+func ValidateModerationReason(v *validator.Validator, reason string) {
+	v.Check(len(reason) <= 500, "reason", "must not be longer than 500 characters")
+}
+
+// settleModeration resolves the report or rejects the hold the action is taken on, in the transaction
+// making the change and before it's made, since deleting held content deletes its pending hold.
+// ErrEditConflict is returned when the report or the hold was already settled, which rolls back the change.
+func settleModeration(ctx context.Context, tx *sql.Tx, action *ModerationAction) error {
+	if r := action.Resolves; r != nil {
+		notices, err := resolveReports(ctx, tx, r.Report, r.Resolution, action.ModeratorID, action.Reason)
+		if err != nil {
+			return err
+		}
+		r.Notices = notices
+	}
+
+	if action.Rejects != nil {
+		return reviewHold(ctx, tx, action.Rejects, false, action.ModeratorID)
+	}
+
+	return nil
+}
+
+// insertModerationAction logs the action as part of the transaction making the change
+func insertModerationAction(ctx context.Context, tx *sql.Tx, action *ModerationAction) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, post_id, comment_id, user_id, report_id, action, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	args := []any{
+		action.ModeratorID,
+		action.PostID,
+		action.CommentID,
+		action.UserID,
+		action.ReportID,
+		action.Action,
+		action.Reason,
+	}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&action.ID, &action.CreatedAt)
+}
+
+type ModerationModel struct {
+	DB *sql.DB
+}
+
+// GetAllForPost returns the moderation log of a post, the latest actions first
+func (m ModerationModel) GetAllForPost(postID int64) ([]*ModerationAction, error) {
+	query := `
+		SELECT a.id, a.created_at, a.moderator_id, u.username, a.post_id, a.comment_id, a.user_id, a.report_id,
+			a.action, a.reason
+		FROM moderation_actions a
+		INNER JOIN users u ON u.id = a.moderator_id
+		WHERE a.post_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+
+	for rows.Next() {
+		var action ModerationAction
+
+		err := rows.Scan(
+			&action.ID,
+			&action.CreatedAt,
+			&action.ModeratorID,
+			&action.Moderator,
+			&action.PostID,
+			&action.CommentID,
+			&action.UserID,
+			&action.ReportID,
+			&action.Action,
+			&action.Reason,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, &action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// HidePost takes a reported post back to draft and marks it hidden, so that it's no longer listed or
+// readable by others and its author can't publish it again, and logs the moderation action along with it
+func (m ModerationModel) HidePost(postID int64, moderation *ModerationAction) error {
+	query := `
+		UPDATE posts
+		SET status = 'draft', hidden_at = COALESCE(hidden_at, NOW()), version = version + 1
+		WHERE id = $1
+	`
+
+	return m.act(postID, moderation, query)
+}
+
+// DeletePost deletes a reported post, and logs the moderation action along with it
+func (m ModerationModel) DeletePost(postID int64, moderation *ModerationAction) error {
+	return m.act(postID, moderation, `DELETE FROM posts WHERE id = $1`)
+}
+
+// SuspendUser locks a user out of the API and logs them out, and logs the moderation action along with it
+func (m ModerationModel) SuspendUser(userID int64, moderation *ModerationAction) error {
+	suspend := `
+		UPDATE users
+		SET suspended_at = COALESCE(suspended_at, NOW()), version = version + 1
+		WHERE id = $1
+	`
+
+	logout := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = 'authentication'
+	`
+
+	return m.act(userID, moderation, suspend, logout)
+}
+
+// act runs the queries on the row with the given id, and logs the moderation action in the same
+// transaction. It returns ErrRecordNotFound when the first query doesn't change any rows.
+func (m ModerationModel) act(id int64, moderation *ModerationAction, queries ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = settleModeration(ctx, tx, moderation)
+	if err != nil {
+		return err
+	}
+
+	for i, query := range queries {
+		res, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			continue
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+	}
+
+	err = insertModerationAction(ctx, tx, moderation)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -11,20 +12,42 @@ import (
 	"github.com/lib/pq"
 )
 
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review" // submitted, waiting for a reviewer
+	StatusApproved  = "approved"  // approved by a reviewer, can be published by an editor
+	StatusPublished = "published"
+)
+
 type Post struct {
-	ID          int64      `json:"id"`
-	CreatedAt   time.Time  `json:"created_at,omitzero"`
-	UpdatedAt   time.Time  `json:"updated_at,omitzero"`
-	UserID      int64      `json:"user_id"`
-	Title       string     `json:"title"`
-	Subtitle    string     `json:"subtitle,omitzero"`
-	Content     string     `json:"content"`
-	Tags        []string   `json:"tags"`
-	Claps       int64      `json:"claps"`
-	Status      string     `json:"status,omitzero"` // Draft or Published
-	PublishedAt *time.Time `json:"published_at"`    // when it in null in the db, json response automatically fills the time as 0.000, and you don't want that, so keep it a pointer
-	Version     int64      `json:"version,omitzero"`
-	Slug        string     `json:"slug"`
+	ID           int64        `json:"id"`
+	CreatedAt    time.Time    `json:"created_at,omitzero"`
+	UpdatedAt    time.Time    `json:"updated_at,omitzero"`
+	UserID       int64        `json:"user_id"`
+	Title        string       `json:"title"`
+	Subtitle     string       `json:"subtitle,omitzero"`
+	Content      string       `json:"content"`
+	Tags         []string     `json:"tags"`
+	Language     string       `json:"language,omitzero"` // ISO 639-1 code, decides how the post is stemmed for search
+	Claps        int64        `json:"claps"`
+	ViewerClaps  *int         `json:"viewer_claps,omitempty"` // how many times the current user clapped the post
+	Bookmarked   *bool        `json:"bookmarked,omitempty"`   // whether the current user saved the post to any of their reading lists
+	Status       string       `json:"status,omitzero"`        // draft, in_review, approved or published
+	CommentsMode string       `json:"comments_mode,omitzero"` // open, locked or disabled
+	Held         bool         `json:"held,omitzero"`          // held for review as possible spam, can't be published until approved
+	Hidden       bool         `json:"hidden,omitzero"`        // hidden by a moderator, only visible to its author and can't be published
+	PublishedAt  *time.Time   `json:"published_at"`           // when it in null in the db, json response automatically fills the time as 0.000, and you don't want that, so keep it a pointer
+	Version      int64        `json:"version,omitzero"`
+	Slug         string       `json:"slug"`
+	WordCount    int          `json:"word_count"`
+	ReadingTime  int          `json:"reading_time"` // in minutes
+	Excerpt      string       `json:"excerpt"`
+	CoverImageID *int64       `json:"cover_image_id"`
+	CoverImage   *Media       `json:"cover_image,omitempty"`
+	Series       *PostSeries  `json:"series,omitempty"`
+	Search       *SearchMatch `json:"search,omitempty"`   // why the post matched, when listed in search results
+	Mentions     []*Mention   `json:"mentions,omitempty"` // the users mentioned in the content
+	ReactionSummary
 }
 
 func ValidatePost(v *validator.Validator, post *Post) {
@@ -38,9 +61,33 @@ func ValidatePost(v *validator.Validator, post *Post) {
 	v.Check(len(post.Content) >= 20, "content", "must be provided")
 	v.Check(len(post.Content) <= 10000, "content", "must not be longer than 25 charcaters")
 
+	// "Go", "go" and "go " are all the same tag
+	post.Tags = NormalizeTags(post.Tags)
+
+	for _, tag := range post.Tags {
+		v.Check(tag != "", "tags", "must contain letters or digits")
+		v.Check(len(tag) <= 50, "tags", "must not be longer than 50 characters each")
+	}
+
 	v.Check(validator.Unique(post.Tags), "tags", "must not contain duplicate values")
 	v.Check(len(post.Tags) >= 1, "tags", "must contain atleast 1 tag")
 	v.Check(len(post.Tags) <= 5, "tags", "must not contain more than 5 tags")
+
+	v.Check(ValidLanguage(post.Language), "language", "must be one of "+strings.Join(Languages(), ", "))
+}
+
+// DetectLanguage sets the language of the post from its text, when it wasn't given
+func (p *Post) DetectLanguage() {
+	if p.Language != "" {
+		return
+	}
+
+	lang, ok := DetectLanguage(strings.Join([]string{p.Title, p.Subtitle, p.Content}, " "), 3)
+	if !ok {
+		lang = DefaultLanguage
+	}
+
+	p.Language = lang
 }
 
 func (p *Post) GenerateSlug() {
@@ -49,17 +96,42 @@ func (p *Post) GenerateSlug() {
 	p.Slug = strings.Join(words, "-")
 }
 
+// editableBy returns a WHERE condition that matches posts which the user in the given
+// placeholder is allowed to edit, i.e. the author or an accepted co-author
+func editableBy(placeholder string) string {
+	return `(user_id = ` + placeholder + ` OR EXISTS (
+			SELECT 1 FROM post_collaborators pc
+			WHERE pc.post_id = posts.id
+				AND pc.user_id = ` + placeholder + `
+				AND pc.role = 'co-author'
+				AND pc.accepted
+		))`
+}
+
+// ComputeReadingStats sets the word count, estimated reading time and a plain text excerpt from the content
+func (p *Post) ComputeReadingStats() {
+	words := strings.Fields(stripMarkdown(p.Content))
+
+	p.WordCount = len(words)
+	p.ReadingTime = max(1, (p.WordCount+wordsPerMinute-1)/wordsPerMinute)
+	p.Excerpt = excerpt(words, excerptLength)
+}
+
 // Model representing Post, which contains a DB connection
 type PostModel struct {
 	DB *sql.DB
 }
 
-// Inserts a Post in the DB, returns an error if failed to do so
-func (m PostModel) Insert(post *Post) error {
+// Insert inserts a new post. A post held for review as possible spam is inserted along with its hold,
+// in the same transaction, and is only held when the hold isn't nil.
+func (m PostModel) Insert(post *Post, hold *SpamHold) error {
+	post.ComputeReadingStats()
+	post.Held = hold != nil
+
 	query := `
-		INSERT INTO posts (title, subtitle, content, tags, slug, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at, slug, claps, status, version
+		INSERT INTO posts (title, subtitle, content, tags, slug, user_id, word_count, reading_time, excerpt, cover_image_id, language, held_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, CASE WHEN $12 THEN NOW() END)
+		RETURNING id, created_at, updated_at, slug, claps, status, comments_mode, version
 	`
 	args := []any{
 		post.Title,
@@ -68,18 +140,31 @@ func (m PostModel) Insert(post *Post) error {
 		pq.Array(post.Tags),
 		post.Slug,
 		post.UserID,
+		post.WordCount,
+		post.ReadingTime,
+		post.Excerpt,
+		post.CoverImageID,
+		post.Language,
+		post.Held,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&post.ID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Slug,
 		&post.Claps,
 		&post.Status,
+		&post.CommentsMode,
 		&post.Version,
 	)
 
@@ -92,13 +177,24 @@ func (m PostModel) Insert(post *Post) error {
 		}
 	}
 
-	return nil
+	if hold != nil {
+		hold.TargetID = post.ID
+
+		err = insertHold(ctx, tx, hold)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Fetch a Post from the DB, returns an error if failed to do so
 func (m PostModel) Get(id int64) (*Post, error) {
 	query := `
-		SELECT id, created_at, user_id, title, subtitle, content, tags, status, claps, slug, updated_at, published_at, version
+		SELECT id, created_at, user_id, title, subtitle, content, tags, status, claps, slug, updated_at, published_at, version,
+			word_count, reading_time, excerpt, cover_image_id, language, comments_mode, held_at IS NOT NULL,
+			hidden_at IS NOT NULL
 		FROM posts
 		WHERE id = $1
 	`
@@ -122,6 +218,14 @@ func (m PostModel) Get(id int64) (*Post, error) {
 		&post.UpdatedAt,
 		&post.PublishedAt,
 		&post.Version,
+		&post.WordCount,
+		&post.ReadingTime,
+		&post.Excerpt,
+		&post.CoverImageID,
+		&post.Language,
+		&post.CommentsMode,
+		&post.Held,
+		&post.Hidden,
 	)
 
 	if err != nil {
@@ -136,71 +240,205 @@ func (m PostModel) Get(id int64) (*Post, error) {
 	return &post, nil
 }
 
-func (m PostModel) GetAll(title string, tags []string, filters Filter) ([]*Post, Metadata, error) {
-	query := `
+// Tag matching modes of a post query
+const (
+	TagModeAll = "all" // posts with all of the tags
+	TagModeAny = "any" // posts with at least one of the tags
+)
+
+// PostQuery selects the published posts listed by GetAll
+type PostQuery struct {
+	Search        string     // web search syntax: "quoted phrases", OR, and -excluded words
+	Language      string     // only posts in this language, all languages when empty
+	Tags          []string   // normalized tags
+	TagMode       string     // all or any
+	Author        string     // username of the author
+	PublishedFrom *time.Time // published on or after this day
+	PublishedTo   *time.Time // published on or before this day, inclusive
+	MinClaps      int64
+}
+
+// PostSortSafelist are the sorts of the post listing
+var PostSortSafelist = []string{
+	SortLatest, SortTrending,
+	"published_at", "-published_at",
+	"claps", "-claps",
+	"title", "-title",
+	"reading_time", "-reading_time",
+}
+
+var postSortColumns = map[string]string{
+	"published_at": "published_at",
+	"claps":        "claps",
+	"title":        "title",
+	"reading_time": "reading_time",
+}
+
+func ValidatePostQuery(v *validator.Validator, q PostQuery) {
+	v.Check(len(q.Search) <= 200, "q", "must not be longer than 200 characters")
+
+	if q.Language != "" {
+		v.Check(ValidLanguage(q.Language), "lang", "must be one of "+strings.Join(Languages(), ", "))
+	}
+
+	v.Check(len(q.Tags) <= 10, "tags", "must not contain more than 10 tags")
+	v.Check(validator.PermittedValue(q.TagMode, TagModeAll, TagModeAny), "tag_mode", "must be all or any")
+
+	v.Check(len(q.Author) <= 32, "author", "must not be longer than 32 bytes")
+
+	if q.PublishedFrom != nil && q.PublishedTo != nil {
+		v.Check(!q.PublishedTo.Before(*q.PublishedFrom), "to", "must not be before from")
+	}
+
+	v.Check(q.MinClaps >= 0, "min_claps", "must not be negative")
+}
+
+// fuzzySearch returns the search for trigram matching of titles, which only makes sense for plain
+// words. A search with phrases, OR or exclusions would match titles the full-text search excludes,
+// so nothing is matched by similarity then.
+func fuzzySearch(search string) string {
+	for _, word := range strings.Fields(search) {
+		if strings.HasPrefix(word, "-") || strings.Contains(word, `"`) || strings.EqualFold(word, "or") {
+			return ""
+		}
+	}
+
+	return search
+}
+
+func (m PostModel) GetAll(q PostQuery, filters Filter) ([]*Post, Metadata, error) {
+	var (
+		ks  keyset
+		err error
+	)
+
+	// only the trending sort reads the scores, and only lists the posts which have one
+	join := ""
+
+	switch {
+	case filters.Sort == SortTrending:
+		ks = keyset{name: SortTrending, columns: []string{"ps.score", "ps.post_id"}, desc: true, uncounted: true}
+		join = "INNER JOIN post_scores ps ON ps.post_id = posts.id"
+	case filters.Sort != SortLatest:
+		ks, err = filters.sortKeyset(postSortColumns, "id")
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	case q.Search == "":
+		ks = keyset{name: SortLatest, columns: []string{"published_at", "id"}, desc: true}
+	default:
+		// a cursor of one search can't be used for another, since the ranks are different
+		ks = keyset{
+			name: "relevance:" + q.Search,
+			columns: []string{
+				"ts_rank(search_vector, websearch_to_tsquery(post_search_config(language), $1))",
+				"word_similarity($2, title)",
+				"published_at",
+				"id",
+			},
+			desc: true,
+		}
+	}
+
+	args := []any{
+		q.Search,
+		fuzzySearch(q.Search),
+		pq.Array(q.Tags),
+		q.TagMode,
+		q.Author,
+		q.PublishedFrom,
+		q.PublishedTo,
+		q.MinClaps,
+		q.Language,
+	}
+
+	page, err := filters.paginate(ks, len(args))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
 		SELECT 
-			count(*) OVER(),
+			%s,
 			id,
 			slug,
 			title,
 			subtitle,
 			published_at,
 			tags,
-			claps
+			claps,
+			word_count,
+			reading_time,
+			excerpt,
+			cover_image_id,
+			language
 		FROM posts
+		%s
 		WHERE status = 'published' 
-			AND (search_vector @@ plainto_tsquery('english', $1) OR $1 = '')
-			AND (tags @> $2 OR $2 = '{}') 
-		ORDER BY
-			(CASE WHEN $1 = '' THEN 1 ELSE 0 END),  -- 0 = search mode, 1 = normal mode
-			ts_rank(search_vector, plainto_tsquery('english', $1)) DESC,
-			published_at DESC
-		LIMIT $3 OFFSET $4
-	`
+			AND (%s OR $2 <%% title OR $1 = '')
+			AND ($3 = '{}' OR ($4 = 'all' AND tags @> $3) OR ($4 = 'any' AND tags && $3))
+			AND ($5 = '' OR user_id = (SELECT id FROM users WHERE username = $5))
+			AND ($6::timestamptz IS NULL OR published_at >= $6)
+			AND ($7::timestamptz IS NULL OR published_at < $7::timestamptz + interval '1 day')
+			AND claps >= $8
+			AND ($9 = '' OR language = $9)
+			AND %s
+		ORDER BY %s
+		%s
+	`, page.Columns, join, matchSearch("websearch_to_tsquery", "$1"), page.Where, page.OrderBy, page.Limit)
 
 	/*
 		Search behavior:
-		1. plainto_tsquery() turns the raw search string into a tsquery.
+		1. websearch_to_tsquery() turns the search string into a tsquery, supporting "quoted phrases",
+		OR between words and -excluded words, the way web search engines do. Malformed input never
+		raises an error, it's interpreted as well as possible.
 		2. search_vector @@ tsquery matches posts based on weighted full-text search
-		(title = A, subtitle = B, content = C).
-		3. If the search string ($1) is empty, the full-text search filter is skipped.
-
-		Ordering behavior:
-		We use a CASE expression to switch between two sorting modes:
-
-		- When $1 = ''  → normal listing mode
-			* CASE returns 1
-			* ts_rank is ignored (all rows have rank 0 anyway)
-			* posts are ordered by published_at DESC
-
-		- When $1 != '' → search mode
-			* CASE returns 0
-			* rows are ordered primarily by ts_rank DESC (relevance)
-			* ties are broken using published_at DESC
-
-		This avoids mixing incompatible types in a CASE expression (timestamp vs real)
-		and cleanly falls back to date sorting when no search term is provided.
+		(title = A, subtitle = B, content = C). The tsquery is built with the text search configuration
+		of the language of each post, the same one its search_vector was built with.
+		3. $2 <% title also matches titles containing words similar to the search string
+		(pg_trgm word similarity), so that misspelled searches still find something. $2 is empty,
+		and so matches nothing, when the search uses any of the operators above.
+		4. If the search string ($1) is empty, the full-text search filter is skipped.
+
+		Filters:
+		- tags match all of $3 (@>) or any of them (&&) depending on the tag mode $4
+		- the author $5 is matched by username, an unknown username matches no posts
+		- the date range $6 - $7 includes the whole day of $7
+		- $9 limits the posts to a language
+
+		Ordering behavior (the keyset above):
+		- with sort=latest and without a search, posts are ordered by published_at DESC
+		- with sort=latest and a search, rows are ordered primarily by ts_rank DESC (relevance), then by
+		the similarity of the title, which ranks the misspelled matches (rank 0), then by published_at DESC
+		- with sort=trending the precomputed scores in post_scores are used instead, walking their
+		index. Posts without a score aren't trending and aren't listed, and the list isn't counted.
+		- any other sort orders by one of the postSortColumns, e.g. -claps by claps DESC
+
+		Ties are always broken by the id, so that the order is stable across pages.
 	*/
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(tags), filters.limit(), filters.offset()}
-
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, append(args, page.Args...)...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
 	posts := []*Post{}
+	keys := []string{}
 	totalRecords := 0
 
 	for rows.Next() {
-		var post Post
+		var (
+			post Post
+			key  string
+		)
 
 		err := rows.Scan(
 			&totalRecords,
+			&key,
 			&post.ID,
 			&post.Slug,
 			&post.Title,
@@ -208,6 +446,11 @@ func (m PostModel) GetAll(title string, tags []string, filters Filter) ([]*Post,
 			&post.PublishedAt,
 			pq.Array(&post.Tags),
 			&post.Claps,
+			&post.WordCount,
+			&post.ReadingTime,
+			&post.Excerpt,
+			&post.CoverImageID,
+			&post.Language,
 		)
 
 		if err != nil {
@@ -215,19 +458,25 @@ func (m PostModel) GetAll(title string, tags []string, filters Filter) ([]*Post,
 		}
 
 		posts = append(posts, &post)
+		keys = append(keys, key)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	posts, metadata := finishPage(page, posts, keys, totalRecords)
 
 	return posts, metadata, nil
 }
 
 // Update a Post, returns an error if failed to do so
-func (m PostModel) Update(post *Post, userID int64) error {
+// Update saves the changes to a post. An edit held for review as possible spam is saved along with its
+// hold, in the same transaction, and the post is only held when the hold isn't nil.
+func (m PostModel) Update(post *Post, userID int64, hold *SpamHold) error {
+	post.ComputeReadingStats()
+	post.Held = hold != nil
+
 	query := `
 		UPDATE posts
 		SET title = $1,
@@ -235,10 +484,17 @@ func (m PostModel) Update(post *Post, userID int64) error {
 			content = $3, 
 			tags = $4, 
 			slug = $5, 
+			status = $6,
+			word_count = $7,
+			reading_time = $8,
+			excerpt = $9,
+			cover_image_id = $10,
+			language = $11,
+			held_at = CASE WHEN $15 THEN NOW() ELSE held_at END,
 			version = version + 1, 
 			updated_at = NOW()
 		WHERE 
-			id = $6 AND version = $7 AND user_id = $8
+			id = $12 AND version = $13 AND ` + editableBy("$14") + `
 		RETURNING version
 	`
 	args := []any{
@@ -247,15 +503,28 @@ func (m PostModel) Update(post *Post, userID int64) error {
 		post.Content,
 		pq.Array(post.Tags),
 		post.Slug,
+		post.Status,
+		post.WordCount,
+		post.ReadingTime,
+		post.Excerpt,
+		post.CoverImageID,
+		post.Language,
 		post.ID,
 		post.Version,
-		post.UserID,
+		userID,
+		post.Held,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&post.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&post.Version)
 	if err != nil {
 		switch {
 		// if the version was changed, then you wont find the exact row, which means it was edited
@@ -269,7 +538,16 @@ func (m PostModel) Update(post *Post, userID int64) error {
 		}
 	}
 
-	return nil
+	if hold != nil {
+		hold.TargetID = post.ID
+
+		err = insertHold(ctx, tx, hold)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Delete a Post from the DB
@@ -300,16 +578,16 @@ func (m PostModel) Delete(id int64, userID int64) error {
 }
 
 // Publishes a post, updating its status and published_at field
-func (m PostModel) Publish(post *Post) error {
+func (m PostModel) Publish(post *Post, userID int64) error {
 	query := `
 		UPDATE posts
 		SET status = 'published',
 			published_at = NOW(),
 			version = version + 1
-		WHERE id = $1 AND version = $2 AND user_id = $3
+		WHERE id = $1 AND version = $2 AND hidden_at IS NULL AND ` + editableBy("$3") + `
 		RETURNING status, published_at, version
 	`
-	args := []any{post.ID, post.Version, post.UserID}
+	args := []any{post.ID, post.Version, userID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -318,7 +596,7 @@ func (m PostModel) Publish(post *Post) error {
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
 		default:
 			return err
 		}
@@ -327,29 +605,98 @@ func (m PostModel) Publish(post *Post) error {
 	return nil
 }
 
-func (m PostModel) IncrementClap(id int64) error {
+// PublishApproved publishes a post which was approved by a reviewer. Used by editors when
+// review mode is enabled, so unlike Publish it doesn't check the authorship of the post.
+func (m PostModel) PublishApproved(post *Post) error {
 	query := `
 		UPDATE posts
-		SET claps = claps + 1
-		WHERE id = $1
+		SET status = 'published',
+			published_at = NOW(),
+			version = version + 1
+		WHERE id = $1 AND version = $2 AND status = 'approved' AND hidden_at IS NULL
+		RETURNING status, published_at, version
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	err := m.DB.QueryRowContext(ctx, query, post.ID, post.Version).Scan(&post.Status, &post.PublishedAt, &post.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return nil
+}
+
+// SetStatus moves a post to the given status, e.g. from draft to in_review
+func (m PostModel) SetStatus(post *Post, status string) error {
+	query := `
+		UPDATE posts
+		SET status = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING status, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, status, post.ID, post.Version).Scan(&post.Status, &post.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetCommentsMode opens, locks or disables the comments of a post, and logs it as an action of the moderator
+func (m PostModel) SetCommentsMode(post *Post, mode string, moderatorID int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	query := `
+		UPDATE posts
+		SET comments_mode = $1
+		WHERE id = $2
+		RETURNING comments_mode
+	`
+
+	err = tx.QueryRowContext(ctx, query, mode, post.ID).Scan(&post.CommentsMode)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
 	}
 
-	return nil
+	action := &ModerationAction{
+		ModeratorID: moderatorID,
+		PostID:      &post.ID,
+		Action:      commentsModeActions[mode],
+		Reason:      reason,
+	}
+
+	err = insertModerationAction(ctx, tx, action)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
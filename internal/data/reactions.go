@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Types of the things that can be reacted to
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+var ErrDuplicateReaction = errors.New("duplicate reaction")
+
+// ReactionSummary is embedded in the models which can be reacted to
+type ReactionSummary struct {
+	Reactions       map[string]int `json:"reactions,omitempty"`        // number of reactions per emoji
+	ViewerReactions []string       `json:"viewer_reactions,omitempty"` // emoji the current user reacted with
+}
+
+func ValidateReaction(v *validator.Validator, emoji string, allowed []string) {
+	v.Check(emoji != "", "emoji", "must be provided")
+	v.Check(validator.PermittedValue(emoji, allowed...), "emoji", "is not an allowed reaction")
+}
+
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a reaction of the user to a target. A user can react with each emoji only once.
+func (m ReactionModel) Insert(targetType string, targetID, userID int64, emoji string) error {
+	query := `
+		INSERT INTO reactions (target_type, target_id, user_id, emoji)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, targetType, targetID, userID, emoji)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reactions_pkey"`:
+			return ErrDuplicateReaction
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReactionModel) Delete(targetType string, targetID, userID int64, emoji string) error {
+	query := `
+		DELETE FROM reactions
+		WHERE target_type = $1 AND target_id = $2 AND user_id = $3 AND emoji = $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, targetType, targetID, userID, emoji)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Load fills in the reaction counts of targets, which are keyed by their ids, along with the
+// reactions of the viewer
+func (m ReactionModel) Load(targetType string, viewerID int64, targets map[int64]*ReactionSummary) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+
+	query := `
+		SELECT target_id, emoji, count(*), bool_or(user_id = $3)
+		FROM reactions
+		WHERE target_type = $1 AND target_id = ANY($2)
+		GROUP BY target_id, emoji
+		ORDER BY target_id, min(created_at), emoji
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetType, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id     int64
+			emoji  string
+			count  int
+			viewer bool
+		)
+
+		if err := rows.Scan(&id, &emoji, &count, &viewer); err != nil {
+			return err
+		}
+
+		target, ok := targets[id]
+		if !ok {
+			continue
+		}
+
+		if target.Reactions == nil {
+			target.Reactions = make(map[string]int)
+		}
+		target.Reactions[emoji] = count
+
+		if viewer {
+			target.ViewerReactions = append(target.ViewerReactions, emoji)
+		}
+	}
+
+	return rows.Err()
+}
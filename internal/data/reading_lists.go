@@ -0,0 +1,378 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+// DefaultReadingList is the name of the list every user has, which bookmarked posts are saved to
+const DefaultReadingList = "Saved"
+
+var ErrDuplicateReadingList = errors.New("duplicate reading list")
+
+// ReadingList is a named, private collection of posts a user saved for later
+type ReadingList struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	IsDefault bool      `json:"is_default"`
+	PostCount int       `json:"post_count"`
+}
+
+func ValidateReadingList(v *validator.Validator, list *ReadingList) {
+	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 100, "name", "must not be longer than 100 characters")
+	v.Check(!strings.EqualFold(strings.TrimSpace(list.Name), DefaultReadingList), "name", "is reserved for the default list")
+}
+
+type ReadingListModel struct {
+	DB *sql.DB
+}
+
+func (m ReadingListModel) Insert(list *ReadingList) error {
+	query := `
+		INSERT INTO reading_lists (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, list.UserID, list.Name).Scan(&list.ID, &list.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reading_lists_user_id_name_key"`:
+			return ErrDuplicateReadingList
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetDefault returns the default list of the user, creating it the first time it's needed
+func (m ReadingListModel) GetDefault(userID int64) (*ReadingList, error) {
+	query := `
+		INSERT INTO reading_lists (user_id, name, is_default)
+		VALUES ($1, $2, TRUE)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, DefaultReadingList)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT l.id, l.created_at, l.user_id, l.name, l.is_default,
+			(SELECT count(*) FROM reading_list_posts WHERE reading_list_id = l.id)
+		FROM reading_lists l
+		WHERE l.user_id = $1 AND l.is_default
+	`
+
+	return m.scanOne(ctx, query, userID)
+}
+
+// Get returns a list of the user. Reading lists are private, so the lists of other users aren't found.
+func (m ReadingListModel) Get(id, userID int64) (*ReadingList, error) {
+	query := `
+		SELECT l.id, l.created_at, l.user_id, l.name, l.is_default,
+			(SELECT count(*) FROM reading_list_posts WHERE reading_list_id = l.id)
+		FROM reading_lists l
+		WHERE l.id = $1 AND l.user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.scanOne(ctx, query, id, userID)
+}
+
+func (m ReadingListModel) scanOne(ctx context.Context, query string, args ...any) (*ReadingList, error) {
+	var list ReadingList
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.IsDefault,
+		&list.PostCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAllForUser returns the lists of the user, the default one first
+func (m ReadingListModel) GetAllForUser(userID int64) ([]*ReadingList, error) {
+	query := `
+		SELECT l.id, l.created_at, l.user_id, l.name, l.is_default, count(lp.post_id)
+		FROM reading_lists l
+		LEFT JOIN reading_list_posts lp ON lp.reading_list_id = l.id
+		WHERE l.user_id = $1
+		GROUP BY l.id
+		ORDER BY l.is_default DESC, l.created_at, l.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*ReadingList{}
+
+	for rows.Next() {
+		var list ReadingList
+
+		err := rows.Scan(&list.ID, &list.CreatedAt, &list.UserID, &list.Name, &list.IsDefault, &list.PostCount)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// Delete removes a custom list of the user. The default list can't be deleted.
+func (m ReadingListModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM reading_lists
+		WHERE id = $1 AND user_id = $2 AND NOT is_default
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddPost saves a post to a list. Saving a post which is already in the list does nothing.
+func (m ReadingListModel) AddPost(listID, postID int64) error {
+	query := `
+		INSERT INTO reading_list_posts (reading_list_id, post_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, listID, postID)
+	return err
+}
+
+func (m ReadingListModel) RemovePost(listID, postID int64) error {
+	query := `
+		DELETE FROM reading_list_posts
+		WHERE reading_list_id = $1 AND post_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, listID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveBookmark removes a post from all the lists of the user
+func (m ReadingListModel) RemoveBookmark(userID, postID int64) error {
+	query := `
+		DELETE FROM reading_list_posts lp
+		USING reading_lists l
+		WHERE l.id = lp.reading_list_id AND l.user_id = $1 AND lp.post_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetPosts returns the posts saved to a list, most recently saved first.
+// Posts which were unpublished after being saved are left out.
+func (m ReadingListModel) GetPosts(listID int64, filters Filter) ([]*Post, Metadata, error) {
+	page, err := filters.paginate(keyset{name: "added_at", columns: []string{"lp.added_at", "p.id"}, desc: true}, 1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s,
+			p.id,
+			p.slug,
+			p.title,
+			p.subtitle,
+			p.published_at,
+			p.tags,
+			p.claps,
+			p.word_count,
+			p.reading_time,
+			p.excerpt,
+			p.cover_image_id
+		FROM reading_list_posts lp
+		INNER JOIN posts p ON p.id = lp.post_id
+		WHERE lp.reading_list_id = $1 AND p.status = 'published' AND %s
+		ORDER BY %s
+		%s
+	`, page.Columns, page.Where, page.OrderBy, page.Limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, append([]any{listID}, page.Args...)...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	keys := []string{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			post Post
+			key  string
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&key,
+			&post.ID,
+			&post.Slug,
+			&post.Title,
+			&post.Subtitle,
+			&post.PublishedAt,
+			pq.Array(&post.Tags),
+			&post.Claps,
+			&post.WordCount,
+			&post.ReadingTime,
+			&post.Excerpt,
+			&post.CoverImageID,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		posts = append(posts, &post)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	posts, metadata := finishPage(page, posts, keys, totalRecords)
+
+	return posts, metadata, nil
+}
+
+// GetBookmarked returns which of postIDs the user saved to any of their lists
+func (m ReadingListModel) GetBookmarked(userID int64, postIDs []int64) (map[int64]bool, error) {
+	query := `
+		SELECT DISTINCT lp.post_id
+		FROM reading_list_posts lp
+		INNER JOIN reading_lists l ON l.id = lp.reading_list_id
+		WHERE l.user_id = $1 AND lp.post_id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarked := make(map[int64]bool)
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		bookmarked[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookmarked, nil
+}
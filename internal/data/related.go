@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetRelated returns up to limit published posts similar to the post with the given id. Posts are
+// ranked by the number of tags they share with it, and then by how many of the terms of its title
+// and subtitle they contain.
+func (m PostModel) GetRelated(id int64, limit int) ([]*Post, error) {
+	// The terms are taken from the A (title) and B (subtitle) weighted lexemes of the search vector.
+	// They are already stemmed, so the query is built with the simple config which leaves them as they are.
+	query := `
+		WITH src AS (
+			SELECT id, tags, to_tsquery('simple', coalesce((
+				SELECT string_agg(quote_literal(lexeme), ' | ')
+				FROM unnest(tsvector_to_array(ts_filter(search_vector, '{a,b}'))) AS lexeme
+			), '')) AS terms
+			FROM posts
+			WHERE id = $1
+		)
+		SELECT
+			p.id,
+			p.slug,
+			p.title,
+			p.subtitle,
+			p.published_at,
+			p.tags,
+			p.claps,
+			p.word_count,
+			p.reading_time,
+			p.excerpt,
+			p.cover_image_id
+		FROM posts p, src
+		WHERE p.status = 'published'
+			AND p.id <> src.id
+			AND (p.tags && src.tags OR p.search_vector @@ src.terms)
+		ORDER BY
+			cardinality(ARRAY(SELECT unnest(p.tags) INTERSECT SELECT unnest(src.tags))) DESC,
+			ts_rank(p.search_vector, src.terms) DESC,
+			p.published_at DESC,
+			p.id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+
+	for rows.Next() {
+		var post Post
+
+		err := rows.Scan(
+			&post.ID,
+			&post.Slug,
+			&post.Title,
+			&post.Subtitle,
+			&post.PublishedAt,
+			pq.Array(&post.Tags),
+			&post.Claps,
+			&post.WordCount,
+			&post.ReadingTime,
+			&post.Excerpt,
+			&post.CoverImageID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+const PermissionReportsModerate = "reports:moderate"
+
+// ErrDuplicateReport is returned when the user already has an open report on the same content
+var ErrDuplicateReport = errors.New("duplicate report")
+
+// Kinds of content that can be reported
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+)
+
+// ReportReasons are the categories a report falls into
+var ReportReasons = []string{"spam", "harassment", "hate_speech", "violence", "sexual_content", "misinformation", "other"}
+
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"  // a moderator acted on the reported content
+	ReportDismissed = "dismissed" // a moderator found nothing wrong with it
+)
+
+// Resolutions of a report, the action a moderator takes on the reported content
+const (
+	ResolutionDismiss = "dismiss"
+	ResolutionHide    = "hide"
+	ResolutionDelete  = "delete"
+	ResolutionSuspend = "suspend" // suspends the author of the content, or the reported user
+)
+
+// Report flags a post, a comment or a user to the moderators
+type Report struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReporterID int64      `json:"reporter_id"`
+	TargetType string     `json:"target_type"` // post, comment or user
+	TargetID   int64      `json:"target_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitzero"`
+	Status     string     `json:"status"` // open, actioned or dismissed
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *int64     `json:"resolved_by,omitempty"`
+	Resolution string     `json:"resolution,omitzero"`
+	Note       string     `json:"note,omitzero"` // the moderator's note to the reporter
+}
+
+func ValidateReport(v *validator.Validator, report *Report) {
+	v.Check(validator.PermittedValue(report.TargetType, ReportTargetPost, ReportTargetComment, ReportTargetUser), "target_type", "must be one of post, comment or user")
+	v.Check(report.TargetID > 0, "target_id", "must be provided")
+
+	v.Check(report.Reason != "", "reason", "must be provided")
+	v.Check(validator.PermittedValue(report.Reason, ReportReasons...), "reason", "must be one of "+strings.Join(ReportReasons, ", "))
+
+	// the moderators need to know what's wrong when it doesn't fit any of the categories
+	if report.Reason == "other" {
+		v.Check(report.Details != "", "details", "must be provided when the reason is other")
+	}
+	v.Check(len(report.Details) <= 2000, "details", "must not be longer than 2000 characters")
+}
+
+// ValidateResolution checks the resolution of a report on the given kind of content. Users can only
+// be suspended, there's nothing of theirs to hide or delete.
+func ValidateResolution(v *validator.Validator, targetType, resolution, note string) {
+	permitted := []string{ResolutionDismiss, ResolutionHide, ResolutionDelete, ResolutionSuspend}
+	if targetType == ReportTargetUser {
+		permitted = []string{ResolutionDismiss, ResolutionSuspend}
+	}
+
+	v.Check(resolution != "", "resolution", "must be provided")
+	v.Check(validator.PermittedValue(resolution, permitted...), "resolution", "must be one of "+strings.Join(permitted, ", ")+" for a "+targetType)
+
+	v.Check(len(note) <= 2000, "note", "must not be longer than 2000 characters")
+}
+
+// ReportQuery filters the moderation queue, empty fields match all reports
+type ReportQuery struct {
+	Status     string
+	TargetType string
+	Reason     string
+}
+
+func ValidateReportQuery(v *validator.Validator, q ReportQuery) {
+	if q.Status != "" {
+		v.Check(validator.PermittedValue(q.Status, ReportOpen, ReportActioned, ReportDismissed), "status", "must be one of open, actioned or dismissed")
+	}
+
+	if q.TargetType != "" {
+		v.Check(validator.PermittedValue(q.TargetType, ReportTargetPost, ReportTargetComment, ReportTargetUser), "target_type", "must be one of post, comment or user")
+	}
+
+	if q.Reason != "" {
+		v.Check(validator.PermittedValue(q.Reason, ReportReasons...), "reason", "must be one of "+strings.Join(ReportReasons, ", "))
+	}
+}
+
+// ReportSortSafelist are the sorts of the moderation queue, the oldest reports first by default
+var ReportSortSafelist = []string{"created_at", "-created_at"}
+
+var reportSortColumns = map[string]string{
+	"created_at": "created_at",
+}
+
+// ReportNotice is a reporter to let know that their report was resolved
+type ReportNotice struct {
+	ReportID int64
+	Username string
+	Email    string
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+func (m ReportModel) Insert(report *Report) error {
+	query := `
+		INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, status
+	`
+
+	args := []any{report.ReporterID, report.TargetType, report.TargetID, report.Reason, report.Details}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.CreatedAt, &report.Status)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reports_open_unique_idx"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+const reportColumns = `
+	id, created_at, reporter_id, target_type, target_id, reason, details, status,
+	resolved_at, resolved_by, resolution, note`
+
+// reportDest returns the destinations reportColumns are scanned into
+func reportDest(report *Report) []any {
+	return []any{
+		&report.ID,
+		&report.CreatedAt,
+		&report.ReporterID,
+		&report.TargetType,
+		&report.TargetID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.ResolvedAt,
+		&report.ResolvedBy,
+		&report.Resolution,
+		&report.Note,
+	}
+}
+
+func (m ReportModel) Get(id int64) (*Report, error) {
+	query := `
+		SELECT ` + reportColumns + `
+		FROM reports
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var report Report
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(reportDest(&report)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// GetAll returns a page of the moderation queue
+func (m ReportModel) GetAll(q ReportQuery, filters Filter) ([]*Report, Metadata, error) {
+	ks, err := filters.sortKeyset(reportSortColumns, "id")
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	page, err := filters.paginate(ks, 3)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM reports
+		WHERE ($1 = '' OR status = $1)
+			AND ($2 = '' OR target_type = $2)
+			AND ($3 = '' OR reason = $3)
+			AND %s
+		ORDER BY %s
+		%s
+	`, page.Columns, reportColumns, page.Where, page.OrderBy, page.Limit)
+
+	args := append([]any{q.Status, q.TargetType, q.Reason}, page.Args...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	keys := []string{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			report Report
+			key    string
+		)
+
+		err := rows.Scan(append([]any{&totalRecords, &key}, reportDest(&report)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reports = append(reports, &report)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	reports, metadata := finishPage(page, reports, keys, totalRecords)
+
+	return reports, metadata, nil
+}
+
+// ReportResolution resolves a report as part of the moderation action taken on it, in the same
+// transaction, so that the content is only acted on by the moderator who resolves the report
+type ReportResolution struct {
+	Report     *Report
+	Resolution string
+	Notices    []*ReportNotice // the reporters to notify, filled in once the report is resolved
+}
+
+// Resolve closes the report, along with the other open reports on the same content since they're
+// settled by the same decision. It returns the reporters of all of them, to be notified. The report
+// is updated in place, and ErrEditConflict is returned when it was already resolved. Reports which
+// are acted on are resolved through the ModerationAction instead.
+func (m ReportModel) Resolve(report *Report, resolution string, moderatorID int64, note string) ([]*ReportNotice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return resolveReports(ctx, m.DB, report, resolution, moderatorID, note)
+}
+
+// resolveReports runs the queries of Resolve on the database or on the transaction of a moderation action
+func resolveReports(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}, report *Report, resolution string, moderatorID int64, note string) ([]*ReportNotice, error) {
+	status := ReportActioned
+	if resolution == ResolutionDismiss {
+		status = ReportDismissed
+	}
+
+	query := `
+		UPDATE reports r
+		SET status = $1, resolution = $2, resolved_by = $3, note = $4, resolved_at = NOW()
+		FROM users u
+		WHERE u.id = r.reporter_id
+			AND r.target_type = $5
+			AND r.target_id = $6
+			AND r.status = 'open'
+			AND EXISTS (SELECT 1 FROM reports WHERE id = $7 AND status = 'open')
+		RETURNING r.id, r.resolved_at, u.username, u.email
+	`
+
+	args := []any{status, resolution, moderatorID, note, report.TargetType, report.TargetID, report.ID}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notices := []*ReportNotice{}
+	resolved := false
+
+	for rows.Next() {
+		var (
+			notice     ReportNotice
+			resolvedAt time.Time
+		)
+
+		err := rows.Scan(&notice.ReportID, &resolvedAt, &notice.Username, &notice.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		if notice.ReportID == report.ID {
+			resolved = true
+			report.Status = status
+			report.Resolution = resolution
+			report.ResolvedBy = &moderatorID
+			report.ResolvedAt = &resolvedAt
+			report.Note = note
+		}
+
+		notices = append(notices, &notice)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// another moderator got to it first
+	if !resolved {
+		return nil, ErrEditConflict
+	}
+
+	return notices, nil
+}
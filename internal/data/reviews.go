@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+)
+
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// Review is the decision of a reviewer on a post that was submitted for review
+type Review struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PostID     int64     `json:"post_id"`
+	ReviewerID int64     `json:"reviewer_id"`
+	Reviewer   string    `json:"reviewer"`
+	Decision   string    `json:"decision"`
+	Comment    string    `json:"comment,omitzero"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Decision != "", "decision", "must be provided")
+	v.Check(validator.PermittedValue(review.Decision, DecisionApprove, DecisionReject), "decision", "must be either approve or reject")
+
+	// a rejection without a reason isn't of much help to the author
+	if review.Decision == DecisionReject {
+		v.Check(review.Comment != "", "comment", "must be provided when rejecting a post")
+	}
+	v.Check(len(review.Comment) <= 2000, "comment", "must not be longer than 2000 characters")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Insert saves the review and moves the post to the status that follows from the decision,
+// approved on approval and back to draft on rejection. Both happen in a single transaction.
+func (m ReviewModel) Insert(review *Review, post *Post) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := StatusApproved
+	if review.Decision == DecisionReject {
+		status = StatusDraft
+	}
+
+	query := `
+		UPDATE posts
+		SET status = $1, version = version + 1
+		WHERE id = $2 AND version = $3 AND status = 'in_review'
+		RETURNING status, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, status, post.ID, post.Version).Scan(&post.Status, &post.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO post_reviews (post_id, reviewer_id, decision, comment)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	args := []any{review.PostID, review.ReviewerID, review.Decision, review.Comment}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) GetAllForPost(postID int64) ([]*Review, error) {
+	query := `
+		SELECT r.id, r.created_at, r.post_id, r.reviewer_id, u.username, r.decision, r.comment
+		FROM post_reviews r
+		INNER JOIN users u ON u.id = r.reviewer_id
+		WHERE r.post_id = $1
+		ORDER BY r.created_at DESC, r.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&review.ID,
+			&review.CreatedAt,
+			&review.PostID,
+			&review.ReviewerID,
+			&review.Reviewer,
+			&review.Decision,
+			&review.Comment,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
@@ -0,0 +1,305 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Highlighted words are wrapped in these private use characters by ts_headline, which are removed from
+// the text of the post beforehand. They're only replaced with the actual markers after the text is
+// escaped, so that the markup of a post never ends up in a highlight.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// SearchMatch explains why a post matched a search
+type SearchMatch struct {
+	Rank         float64  `json:"rank"`
+	Title        string   `json:"title"`         // the title, with the matched words highlighted
+	Snippet      string   `json:"snippet"`       // fragments of the content around the matched words, highlighted
+	MatchedTerms []string `json:"matched_terms"` // the search terms found in the post
+}
+
+// HighlightOptions configures the snippets and highlights of search matches
+type HighlightOptions struct {
+	StartMarker  string // inserted before a matched word, e.g. <mark>
+	StopMarker   string // inserted after a matched word, e.g. </mark>
+	MaxWords     int    // maximum length of a snippet fragment, in words
+	MaxFragments int    // maximum number of fragments in a snippet
+}
+
+// GetSearchMatches returns the rank, highlighted title and content snippet, and the matched terms of
+// the posts with the given ids for a search, keyed by post id. Highlights are HTML escaped text, with
+// the matched words wrapped in the markers of opts.
+func (m PostModel) GetSearchMatches(search string, ids []int64, opts HighlightOptions) (map[int64]*SearchMatch, error) {
+	matches := make(map[int64]*SearchMatch, len(ids))
+
+	if search == "" || len(ids) == 0 {
+		return matches, nil
+	}
+
+	maxWords := max(opts.MaxWords, 2)
+
+	titleOptions := fmt.Sprintf(`HighlightAll=true, StartSel=%s, StopSel=%s`, highlightStart, highlightStop)
+	snippetOptions := fmt.Sprintf(
+		`StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, MaxFragments=%d, FragmentDelimiter=" … "`,
+		highlightStart, highlightStop, maxWords, maxWords/2, max(opts.MaxFragments, 1),
+	)
+
+	// a search term matched if it isn't a stop word and the post matches it on its own
+	query := `
+		SELECT id,
+			ts_rank(search_vector, websearch_to_tsquery(post_search_config(language), $1)),
+			ts_headline(post_search_config(language), translate(title, $5, ''), websearch_to_tsquery(post_search_config(language), $1), $3),
+			ts_headline(post_search_config(language), translate(content, $5, ''), websearch_to_tsquery(post_search_config(language), $1), $4),
+			ARRAY(
+				SELECT term
+				FROM regexp_split_to_table(lower($1), '\W+') AS term
+				WHERE numnode(plainto_tsquery(post_search_config(language), term)) > 0
+					AND search_vector @@ plainto_tsquery(post_search_config(language), term)
+			)
+		FROM posts
+		WHERE id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, pq.Array(ids), titleOptions, snippetOptions, highlightStart+highlightStop)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id    int64
+			terms []string
+			match SearchMatch
+		)
+
+		err := rows.Scan(&id, &match.Rank, &match.Title, &match.Snippet, pq.Array(&terms))
+		if err != nil {
+			return nil, err
+		}
+
+		match.Title = highlight(match.Title, opts)
+		match.Snippet = highlight(match.Snippet, opts)
+		match.MatchedTerms = uniqueTerms(terms)
+
+		matches[id] = &match
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// highlight escapes a ts_headline result and replaces its highlight characters with the markers
+func highlight(headline string, opts HighlightOptions) string {
+	headline = html.EscapeString(headline)
+	headline = strings.ReplaceAll(headline, highlightStart, opts.StartMarker)
+	return strings.ReplaceAll(headline, highlightStop, opts.StopMarker)
+}
+
+// uniqueTerms drops the repeated terms, keeping their order
+func uniqueTerms(terms []string) []string {
+	unique := make([]string, 0, len(terms))
+	seen := make(map[string]bool, len(terms))
+
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+
+	return unique
+}
+
+// Suggestions are the posts, tags and authors matching a partially typed search
+type Suggestions struct {
+	Posts   []*PostSuggestion   `json:"posts"`
+	Tags    []*TagSuggestion    `json:"tags"`
+	Authors []*AuthorSuggestion `json:"authors"`
+}
+
+type PostSuggestion struct {
+	ID    int64  `json:"id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type TagSuggestion struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type AuthorSuggestion struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// PrefixTSQuery turns a partially typed search into a to_tsquery query matching all of its words,
+// the last of which may be incomplete, e.g. "postgres ind" becomes "postgres & ind:*". Anything other
+// than letters and digits is dropped, so the result is always valid to_tsquery syntax. It's empty
+// when the search has no words.
+func PrefixTSQuery(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if len(words) == 0 {
+		return ""
+	}
+
+	return strings.Join(words, " & ") + ":*"
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// Suggest returns up to limit published posts, tags and authors matching a partially typed search,
+// by prefix or by trigram similarity so that typos are tolerated. The lookups share the budget,
+// and when it runs out the suggestions found so far are returned.
+func (m SearchModel) Suggest(search string, limit int, budget time.Duration) (*Suggestions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+
+	suggestions := &Suggestions{
+		Posts:   []*PostSuggestion{},
+		Tags:    []*TagSuggestion{},
+		Authors: []*AuthorSuggestion{},
+	}
+
+	lookups := []func(context.Context, string, int, *Suggestions) error{
+		m.suggestPosts,
+		m.suggestTags,
+		m.suggestAuthors,
+	}
+
+	for _, lookup := range lookups {
+		err := lookup(ctx, search, limit, suggestions)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	return suggestions, nil
+}
+
+func (m SearchModel) suggestPosts(ctx context.Context, search string, limit int, suggestions *Suggestions) error {
+	query := `
+		SELECT id, slug, title
+		FROM posts
+		WHERE status = 'published'
+			AND (($2 <> '' AND ` + matchSearch("to_tsquery", "$2") + `) OR $1 <% title)
+		ORDER BY
+			(CASE WHEN $2 <> '' THEN ts_rank(search_vector, to_tsquery(post_search_config(language), $2)) ELSE 0 END) DESC,
+			word_similarity($1, title) DESC,
+			published_at DESC
+		LIMIT $3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, search, PrefixTSQuery(search), limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post PostSuggestion
+
+		if err := rows.Scan(&post.ID, &post.Slug, &post.Title); err != nil {
+			return err
+		}
+
+		suggestions.Posts = append(suggestions.Posts, &post)
+	}
+
+	return rows.Err()
+}
+
+func (m SearchModel) suggestTags(ctx context.Context, search string, limit int, suggestions *Suggestions) error {
+	slug := NormalizeTag(search)
+	if slug == "" {
+		return nil
+	}
+
+	// tags starting with the search first, then the most similar ones
+	query := `
+		SELECT slug, name
+		FROM tags
+		WHERE slug LIKE $2 || '%' OR slug % $1
+		ORDER BY slug LIKE $2 || '%' DESC, similarity(slug, $1) DESC, slug
+		LIMIT $3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, slug, escapeLike(slug), limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag TagSuggestion
+
+		if err := rows.Scan(&tag.Slug, &tag.Name); err != nil {
+			return err
+		}
+
+		suggestions.Tags = append(suggestions.Tags, &tag)
+	}
+
+	return rows.Err()
+}
+
+// suggestAuthors only suggests users who have published a post
+func (m SearchModel) suggestAuthors(ctx context.Context, search string, limit int, suggestions *Suggestions) error {
+	query := `
+		SELECT u.id, u.username
+		FROM users u
+		WHERE (u.username ILIKE $2 || '%' OR u.username % $1)
+			AND EXISTS (SELECT 1 FROM posts p WHERE p.user_id = u.id AND p.status = 'published')
+		ORDER BY u.username ILIKE $2 || '%' DESC, similarity(u.username, $1) DESC, u.username
+		LIMIT $3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, search, escapeLike(search), limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var author AuthorSuggestion
+
+		if err := rows.Scan(&author.ID, &author.Username); err != nil {
+			return err
+		}
+
+		suggestions.Authors = append(suggestions.Authors, &author)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,345 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+var ErrPostInSeries = errors.New("post already in a series")
+
+// Series groups multiple posts of a user into an ordered collection, e.g. a multi-part tutorial
+type Series struct {
+	ID          int64         `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	UserID      int64         `json:"user_id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description,omitzero"`
+	Posts       []*SeriesPost `json:"posts,omitempty"`
+	Version     int64         `json:"version"`
+}
+
+// SeriesPost is a short summary of a post, as it appears inside a series
+type SeriesPost struct {
+	Position int    `json:"position"`
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Slug     string `json:"slug"`
+	Status   string `json:"status"`
+}
+
+// PostSeries is the series information attached to a single post response
+type PostSeries struct {
+	ID         int64       `json:"id"`
+	Title      string      `json:"title"`
+	Part       int         `json:"part"`
+	TotalParts int         `json:"total_parts"`
+	Previous   *SeriesPost `json:"previous"`
+	Next       *SeriesPost `json:"next"`
+}
+
+func ValidateSeries(v *validator.Validator, s *Series) {
+	v.Check(s.Title != "", "title", "must be provided")
+	v.Check(len(s.Title) <= 120, "title", "must not be longer than 120 characters")
+
+	v.Check(len(s.Description) <= 500, "description", "must not be longer than 500 characters")
+}
+
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+func (m SeriesModel) Insert(series *Series) error {
+	query := `
+		INSERT INTO series (user_id, title, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.UserID, series.Title, series.Description).Scan(
+		&series.ID,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+		&series.Version,
+	)
+}
+
+func (m SeriesModel) Get(id int64) (*Series, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, title, description, version
+		FROM series
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var series Series
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&series.ID,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+		&series.UserID,
+		&series.Title,
+		&series.Description,
+		&series.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &series, nil
+}
+
+// GetPosts returns the posts of a series in order. Drafts are only included
+// when the viewer is the owner of the series.
+func (m SeriesModel) GetPosts(seriesID, viewerID int64) ([]*SeriesPost, error) {
+	query := `
+		SELECT sp.position, p.id, p.title, p.slug, p.status
+		FROM series_posts sp
+		INNER JOIN series s ON s.id = sp.series_id
+		INNER JOIN posts p ON p.id = sp.post_id
+		WHERE sp.series_id = $1
+			AND (p.status = 'published' OR s.user_id = $2)
+		ORDER BY sp.position
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, seriesID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*SeriesPost{}
+
+	for rows.Next() {
+		var p SeriesPost
+
+		err := rows.Scan(&p.Position, &p.ID, &p.Title, &p.Slug, &p.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, &p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetForPost returns the series info of a post along with its previous and next posts.
+// Returns nil if the post is not a part of any series.
+func (m SeriesModel) GetForPost(postID, viewerID int64) (*PostSeries, error) {
+	query := `
+		SELECT s.id, s.title
+		FROM series s
+		INNER JOIN series_posts sp ON sp.series_id = s.id
+		WHERE sp.post_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ps PostSeries
+
+	err := m.DB.QueryRowContext(ctx, query, postID).Scan(&ps.ID, &ps.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	posts, err := m.GetPosts(ps.ID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.TotalParts = len(posts)
+
+	for i, p := range posts {
+		if p.ID != postID {
+			continue
+		}
+
+		ps.Part = i + 1
+		if i > 0 {
+			ps.Previous = posts[i-1]
+		}
+		if i < len(posts)-1 {
+			ps.Next = posts[i+1]
+		}
+	}
+
+	return &ps, nil
+}
+
+func (m SeriesModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM series
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddPost appends a post at the end of a series, bumping the version of the series
+func (m SeriesModel) AddPost(series *Series, postID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the update locks the series row, so concurrent adds wait for each other instead of both taking
+	// the same position
+	query := `
+		UPDATE series
+		SET version = version + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, series.ID).Scan(&series.UpdatedAt, &series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO series_posts (series_id, post_id, position)
+		SELECT $1, $2, coalesce(max(position), 0) + 1
+		FROM series_posts
+		WHERE series_id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, series.ID, postID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "series_posts_post_id_key"`,
+			err.Error() == `pq: duplicate key value violates unique constraint "series_posts_pkey"`:
+			return ErrPostInSeries
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m SeriesModel) RemovePost(seriesID, postID int64) error {
+	query := `
+		DELETE FROM series_posts
+		WHERE series_id = $1 AND post_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, seriesID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Reorder sets the positions of the posts in a series to the order of postIDs.
+// postIDs must contain every post of the series exactly once, the caller is expected to check that.
+func (m SeriesModel) Reorder(series *Series, postIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// bumping the version first, so that two concurrent reorders can't interleave
+	query := `
+		UPDATE series
+		SET version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND version = $2
+		RETURNING updated_at, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, series.ID, series.Version).Scan(&series.UpdatedAt, &series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE series_posts sp
+		SET position = o.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(post_id, position)
+		WHERE sp.series_id = $1 AND sp.post_id = o.post_id
+	`
+
+	_, err = tx.ExecContext(ctx, query, series.ID, pq.Array(postIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,378 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/spam"
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Kinds of content held for review
+const (
+	HoldTargetPost    = "post"
+	HoldTargetComment = "comment"
+)
+
+// Statuses of held content
+const (
+	HoldHeld     = "held"
+	HoldApproved = "approved"
+	HoldRejected = "rejected"
+)
+
+// SpamHold is a post or comment the spam checks held for review
+type SpamHold struct {
+	ID         int64          `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	TargetType string         `json:"target_type"` // post or comment
+	TargetID   int64          `json:"target_id"`
+	AuthorID   int64          `json:"author_id"`
+	Content    string         `json:"content"` // the text as it was when it was held
+	Score      float64        `json:"score"`
+	Signals    []*spam.Signal `json:"signals"`
+	Status     string         `json:"status"` // held, approved or rejected
+	ReviewedBy *int64         `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time     `json:"reviewed_at,omitempty"`
+}
+
+func ValidateHoldStatus(v *validator.Validator, status string) {
+	v.Check(validator.PermittedValue(status, HoldHeld, HoldApproved, HoldRejected), "status", "must be one of held, approved or rejected")
+}
+
+type SpamModel struct {
+	DB *sql.DB
+}
+
+// CountFingerprints returns how many times content with the fingerprint was posted since the given time
+func (m SpamModel) CountFingerprints(ctx context.Context, fingerprint []byte, since time.Time) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM content_fingerprints
+		WHERE fingerprint = $1 AND created_at >= $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, fingerprint, since).Scan(&count)
+	return count, err
+}
+
+// RecordFingerprint records that the user posted content with the fingerprint
+func (m SpamModel) RecordFingerprint(fingerprint []byte, userID int64) error {
+	query := `
+		INSERT INTO content_fingerprints (fingerprint, user_id)
+		VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, fingerprint, userID)
+	return err
+}
+
+// DeleteExpiredFingerprints forgets the fingerprints recorded before the given time, which no check
+// looks at anymore, and returns how many were deleted
+func (m SpamModel) DeleteExpiredFingerprints(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM content_fingerprints WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// TokenCounts returns the spam and ham counts of the tokens the classifier was trained on, and the
+// number of spam and ham documents it was trained on
+func (m SpamModel) TokenCounts(ctx context.Context, tokens []string) (map[string]spam.TokenCount, int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			COALESCE((SELECT count FROM spam_documents WHERE class = 'spam'), 0),
+			COALESCE((SELECT count FROM spam_documents WHERE class = 'ham'), 0)
+	`
+
+	var spamDocs, hamDocs int
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&spamDocs, &hamDocs)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	query = `
+		SELECT token, spam_count, ham_count
+		FROM spam_tokens
+		WHERE token = ANY($1)
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(tokens))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]spam.TokenCount)
+
+	for rows.Next() {
+		var (
+			token string
+			count spam.TokenCount
+		)
+
+		if err := rows.Scan(&token, &count.Spam, &count.Ham); err != nil {
+			return nil, 0, 0, err
+		}
+
+		counts[token] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return counts, spamDocs, hamDocs, nil
+}
+
+// Train teaches the classifier that a text with the tokens is spam, or not
+func (m SpamModel) Train(tokens []string, isSpam bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = train(ctx, tx, tokens, isSpam)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func train(ctx context.Context, tx *sql.Tx, tokens []string, isSpam bool) error {
+	class, spamCount, hamCount := "ham", 0, 1
+	if isSpam {
+		class, spamCount, hamCount = "spam", 1, 0
+	}
+
+	query := `
+		INSERT INTO spam_tokens (token, spam_count, ham_count)
+		SELECT unnest($1::text[]), $2, $3
+		ON CONFLICT (token) DO UPDATE
+		SET spam_count = spam_tokens.spam_count + EXCLUDED.spam_count,
+			ham_count = spam_tokens.ham_count + EXCLUDED.ham_count
+	`
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(tokens), spamCount, hamCount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE spam_documents SET count = count + 1 WHERE class = $1`, class)
+	return err
+}
+
+// insertHold adds held content to the review queue, in the transaction inserting or editing the content.
+// An edit of content which was approved before puts it back in the queue, replacing the old review.
+func insertHold(ctx context.Context, tx *sql.Tx, hold *SpamHold) error {
+	signals, err := json.Marshal(hold.Signals)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO spam_holds (target_type, target_id, author_id, content, score, signals)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (target_type, target_id) DO UPDATE
+		SET created_at = NOW(), author_id = EXCLUDED.author_id, content = EXCLUDED.content, score = EXCLUDED.score,
+			signals = EXCLUDED.signals, status = 'held', reviewed_by = NULL, reviewed_at = NULL
+		RETURNING id, created_at, status
+	`
+
+	args := []any{hold.TargetType, hold.TargetID, hold.AuthorID, hold.Content, hold.Score, signals}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&hold.ID, &hold.CreatedAt, &hold.Status)
+}
+
+const holdColumns = `
+	id, created_at, target_type, target_id, author_id, content, score, signals, status, reviewed_by, reviewed_at`
+
+// scanHold scans the holdColumns, after the given destinations, into hold
+func scanHold(row interface{ Scan(...any) error }, hold *SpamHold, dest ...any) error {
+	var signals []byte
+
+	dest = append(dest,
+		&hold.ID,
+		&hold.CreatedAt,
+		&hold.TargetType,
+		&hold.TargetID,
+		&hold.AuthorID,
+		&hold.Content,
+		&hold.Score,
+		&signals,
+		&hold.Status,
+		&hold.ReviewedBy,
+		&hold.ReviewedAt,
+	)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(signals, &hold.Signals)
+}
+
+func (m SpamModel) GetHold(id int64) (*SpamHold, error) {
+	query := `
+		SELECT ` + holdColumns + `
+		FROM spam_holds
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hold SpamHold
+
+	err := scanHold(m.DB.QueryRowContext(ctx, query, id), &hold)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &hold, nil
+}
+
+// GetHolds returns a page of the review queue with the given status, the oldest first
+func (m SpamModel) GetHolds(status string, filters Filter) ([]*SpamHold, Metadata, error) {
+	page, err := filters.paginate(keyset{name: "created_at", columns: []string{"created_at", "id"}}, 1)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM spam_holds
+		WHERE status = $1 AND %s
+		ORDER BY %s
+		%s
+	`, page.Columns, holdColumns, page.Where, page.OrderBy, page.Limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, append([]any{status}, page.Args...)...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	holds := []*SpamHold{}
+	keys := []string{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			hold SpamHold
+			key  string
+		)
+
+		if err := scanHold(rows, &hold, &totalRecords, &key); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		holds = append(holds, &hold)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	holds, metadata := finishPage(page, holds, keys, totalRecords)
+
+	return holds, metadata, nil
+}
+
+// Review records the decision of a moderator on held content, and trains the classifier with it. An
+// approved post or comment is released. Rejected content which still exists is deleted through a
+// ModerationAction rejecting the hold instead, so that it's only deleted while still held.
+// ErrEditConflict is returned when the content was already reviewed.
+func (m SpamModel) Review(hold *SpamHold, approve bool, moderatorID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = reviewHold(ctx, tx, hold, approve, moderatorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// reviewHold runs the queries of Review on the transaction
+func reviewHold(ctx context.Context, tx *sql.Tx, hold *SpamHold, approve bool, moderatorID int64) error {
+	status := HoldRejected
+	if approve {
+		status = HoldApproved
+	}
+
+	query := `
+		UPDATE spam_holds
+		SET status = $1, reviewed_by = $2, reviewed_at = NOW()
+		WHERE id = $3 AND status = 'held'
+		RETURNING status, reviewed_by, reviewed_at
+	`
+
+	err := tx.QueryRowContext(ctx, query, status, moderatorID, hold.ID).Scan(&hold.Status, &hold.ReviewedBy, &hold.ReviewedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if approve {
+		// the table names can't be parameters, target_type is one of the two from the CHECK constraint
+		table := "comments"
+		if hold.TargetType == HoldTargetPost {
+			table = "posts"
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE `+table+` SET held_at = NULL WHERE id = $1`, hold.TargetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return train(ctx, tx, spam.Tokenize(hold.Content), !approve)
+}
@@ -0,0 +1,430 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Infamous003/go-blog/internal/validator"
+	"github.com/lib/pq"
+)
+
+const PermissionTagsManage = "tags:manage"
+
+var ErrDuplicateAlias = errors.New("duplicate alias")
+
+var (
+	tagSeparatorRX = regexp.MustCompile(`[\s_-]+`)
+	tagInvalidRX   = regexp.MustCompile(`[^\p{L}\p{N}+#.-]`)
+)
+
+// Tag is a topic posts are filed under. Posts refer to tags by their slug.
+type Tag struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Aliases     []string  `json:"aliases,omitempty"`
+	PostCount   int       `json:"post_count"` // number of published posts
+}
+
+// NormalizeTag turns a tag into its slug form, so that e.g. "Go", "go" and "go " are the same tag.
+// Runs of whitespace, underscores and hyphens become a single hyphen, and anything other than
+// letters, digits and +#. (as in c++, c# and .net) is dropped.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag = tagSeparatorRX.ReplaceAllString(tag, "-")
+	tag = tagInvalidRX.ReplaceAllString(tag, "")
+
+	return strings.Trim(tag, "-")
+}
+
+// NormalizeTags normalizes every tag in tags
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, NormalizeTag(tag))
+	}
+
+	return normalized
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(len(tag.Name) <= 50, "name", "must not be longer than 50 characters")
+
+	v.Check(len(tag.Description) <= 500, "description", "must not be longer than 500 characters")
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// Resolve replaces the aliases in the normalized tags like ResolveAliases does, and creates the tags
+// that don't exist yet
+func (m TagModel) Resolve(tags []string) ([]string, error) {
+	resolved, err := m.ResolveAliases(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO tags (slug, name)
+		SELECT slug, slug
+		FROM unnest($1::text[]) AS slug
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, pq.Array(resolved))
+	if err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// ResolveAliases replaces the aliases in the normalized tags with the slug of their tag, and drops
+// the duplicates this may cause
+func (m TagModel) ResolveAliases(tags []string) ([]string, error) {
+	query := `
+		SELECT a.alias, t.slug
+		FROM tag_aliases a
+		INNER JOIN tags t ON t.id = a.tag_id
+		WHERE a.alias = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+
+	for rows.Next() {
+		var alias, slug string
+
+		if err := rows.Scan(&alias, &slug); err != nil {
+			return nil, err
+		}
+
+		aliases[alias] = slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		if slug, ok := aliases[tag]; ok {
+			tag = slug
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			resolved = append(resolved, tag)
+		}
+	}
+
+	return resolved, nil
+}
+
+// GetAll returns the tags along with their number of published posts, the most used first
+func (m TagModel) GetAll(filters Filter) ([]*Tag, Metadata, error) {
+	page, err := filters.paginate(keyset{name: "post_count", columns: []string{"post_count", "id"}, desc: true}, 0)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// the post counts are computed in a subquery, so that the cursor can be compared to them
+	query := fmt.Sprintf(`
+		SELECT %s, id, created_at, slug, name, description, post_count
+		FROM (
+			SELECT t.id, t.created_at, t.slug, t.name, t.description, count(p.id) AS post_count
+			FROM tags t
+			LEFT JOIN posts p ON p.tags @> ARRAY[t.slug] AND p.status = 'published'
+			GROUP BY t.id
+		) t
+		WHERE %s
+		ORDER BY %s
+		%s
+	`, page.Columns, page.Where, page.OrderBy, page.Limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, page.Args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	keys := []string{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var (
+			tag Tag
+			key string
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&key,
+			&tag.ID,
+			&tag.CreatedAt,
+			&tag.Slug,
+			&tag.Name,
+			&tag.Description,
+			&tag.PostCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tags = append(tags, &tag)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	tags, metadata := finishPage(page, tags, keys, totalRecords)
+
+	return tags, metadata, nil
+}
+
+// GetBySlug returns the tag with the given slug, or the tag the slug is an alias of
+func (m TagModel) GetBySlug(slug string) (*Tag, error) {
+	query := `
+		SELECT t.id, t.created_at, t.slug, t.name, t.description,
+			ARRAY(SELECT alias FROM tag_aliases WHERE tag_id = t.id ORDER BY alias),
+			(SELECT count(*) FROM posts p WHERE p.tags @> ARRAY[t.slug] AND p.status = 'published')
+		FROM tags t
+		WHERE t.slug = $1
+			OR t.id = (SELECT tag_id FROM tag_aliases WHERE alias = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tag Tag
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+		&tag.ID,
+		&tag.CreatedAt,
+		&tag.Slug,
+		&tag.Name,
+		&tag.Description,
+		pq.Array(&tag.Aliases),
+		&tag.PostCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+func (m TagModel) Update(tag *Tag) error {
+	query := `
+		UPDATE tags
+		SET name = $1, description = $2
+		WHERE id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, tag.Name, tag.Description, tag.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddAlias makes alias another name of the tag. If alias is a tag of its own, it's merged into
+// the tag: its posts, aliases and followers move over, and it's deleted.
+func (m TagModel) AddAlias(tag *Tag, alias string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var mergedID int64
+
+	err = tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE slug = $1`, alias).Scan(&mergedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if mergedID != 0 {
+		// replacing the merged tag in the posts, keeping the first occurrence if a post had both tags
+		query := `
+			UPDATE posts
+			SET tags = ARRAY(
+					SELECT t
+					FROM unnest(array_replace(tags, $1::text, $2::text)) WITH ORDINALITY AS u(t, n)
+					GROUP BY t
+					ORDER BY min(n)
+				),
+				version = version + 1
+			WHERE tags @> ARRAY[$1::text]
+		`
+
+		_, err = tx.ExecContext(ctx, query, alias, tag.Slug)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE tag_aliases SET tag_id = $1 WHERE tag_id = $2`, tag.ID, mergedID)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO tag_follows (user_id, tag_id, created_at)
+			SELECT user_id, $1, created_at
+			FROM tag_follows
+			WHERE tag_id = $2
+			ON CONFLICT DO NOTHING
+		`
+
+		_, err = tx.ExecContext(ctx, query, tag.ID, mergedID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, mergedID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO tag_aliases (alias, tag_id) VALUES ($1, $2)`, alias, tag.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tag_aliases_pkey"`:
+			return ErrDuplicateAlias
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Follow subscribes the user to the tag. Following a tag twice does nothing.
+func (m TagModel) Follow(userID, tagID int64) error {
+	query := `
+		INSERT INTO tag_follows (user_id, tag_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, tagID)
+	return err
+}
+
+func (m TagModel) Unfollow(userID, tagID int64) error {
+	query := `
+		DELETE FROM tag_follows
+		WHERE user_id = $1 AND tag_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, tagID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetFollowed returns the tags the user follows
+func (m TagModel) GetFollowed(userID int64) ([]*Tag, error) {
+	query := `
+		SELECT t.id, t.created_at, t.slug, t.name, t.description
+		FROM tags t
+		INNER JOIN tag_follows f ON f.tag_id = t.id
+		WHERE f.user_id = $1
+		ORDER BY t.slug
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+
+	for rows.Next() {
+		var tag Tag
+
+		err := rows.Scan(&tag.ID, &tag.CreatedAt, &tag.Slug, &tag.Name, &tag.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -13,6 +13,7 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeUnsubscribe    = "unsubscribe" // sent with digest emails, to unsubscribe without logging in
 )
 
 type Token struct {
@@ -80,3 +81,20 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired deletes the expired tokens of a scope
+func (m TokenModel) DeleteExpired(scope string) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND expiry < NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Sort orders of the post listing, besides sorting by one of the postSortColumns
+const (
+	SortLatest   = "latest"   // most recently published first, or the most relevant first when searching
+	SortTrending = "trending" // highest trending score first
+)
+
+// RefreshTrendingScores recomputes the trending score of every post with recent activity. Each view,
+// clap, comment and the publication itself add to the score of a post, with a weight halving every
+// halfLife, so that recent activity counts the most. Activity older than window is ignored.
+func (m PostModel) RefreshTrendingScores(halfLife, window time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the listing keeps reading the previous scores until the transaction commits
+	_, err = tx.ExecContext(ctx, `DELETE FROM post_scores`)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		WITH events (post_id, happened_at, weight) AS (
+			SELECT post_id, viewed_at, 1.0
+			FROM post_views
+			WHERE viewed_at > NOW() - make_interval(secs => $2)
+			UNION ALL
+			SELECT post_id, created_at, 2.0 * delta
+			FROM post_clap_events
+			WHERE created_at > NOW() - make_interval(secs => $2)
+			UNION ALL
+			SELECT post_id, created_at, 5.0
+			FROM comments
+			WHERE created_at > NOW() - make_interval(secs => $2)
+			UNION ALL
+			-- a head start, so that new posts get a chance to be seen
+			SELECT id, published_at, 10.0
+			FROM posts
+			WHERE status = 'published' AND published_at > NOW() - make_interval(secs => $2)
+		)
+		INSERT INTO post_scores (post_id, score)
+		SELECT e.post_id, sum(e.weight * power(0.5, extract(epoch FROM NOW() - e.happened_at) / $1))
+		FROM events e
+		INNER JOIN posts p ON p.id = e.post_id
+		WHERE p.status = 'published'
+		GROUP BY e.post_id
+		HAVING sum(e.weight) > 0
+	`
+
+	res, err := tx.ExecContext(ctx, query, halfLife.Seconds(), window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, tx.Commit()
+}
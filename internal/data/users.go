@@ -25,6 +25,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Suspended bool      `json:"suspended,omitzero"` // suspended by a moderator, locked out of the API
 	Version   int       `json:"-"`
 }
 
@@ -129,7 +130,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password_hash, activated, version
+		SELECT id, created_at, username, email, password_hash, activated, suspended_at IS NOT NULL, version
 		FROM users
 		WHERE email = $1
 	`
@@ -146,6 +147,77 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, username, email, password_hash, activated, suspended_at IS NOT NULL, version
+		FROM users
+		WHERE id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) GetByUsername(username string) (*User, error) {
+	query := `
+		SELECT id, created_at, username, email, password_hash, activated, suspended_at IS NOT NULL, version
+		FROM users
+		WHERE username = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 
@@ -211,6 +283,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 			   users.email, 
 			   users.password_hash, 
 			   users.activated, 
+			   users.suspended_at IS NOT NULL,
 			   users.version
 		FROM users
 		INNER JOIN tokens
@@ -234,6 +307,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
 		&user.Version,
 	)
 	if err != nil {
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostView is a single read of a post
+type PostView struct {
+	PostID     int64
+	ViewerHash string
+	ViewedAt   time.Time
+}
+
+// PostStats is the engagement of a post, in total and per day
+type PostStats struct {
+	Views         int64       `json:"views"`
+	UniqueReaders int64       `json:"unique_readers"`
+	Claps         int64       `json:"claps"`
+	Comments      int64       `json:"comments"`
+	Daily         []*DayStats `json:"daily"`
+}
+
+type DayStats struct {
+	Date          string `json:"date"` // YYYY-MM-DD
+	Views         int64  `json:"views"`
+	UniqueReaders int64  `json:"unique_readers"`
+	Claps         int64  `json:"claps"` // net claps of the day, taken back claps are subtracted
+	Comments      int64  `json:"comments"`
+}
+
+type ViewModel struct {
+	DB *sql.DB
+}
+
+// InsertBatch saves many views in a single query
+func (m ViewModel) InsertBatch(views []PostView) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int64, len(views))
+	hashes := make([]string, len(views))
+	times := make([]string, len(views))
+
+	for i, view := range views {
+		postIDs[i] = view.PostID
+		hashes[i] = view.ViewerHash
+		times[i] = view.ViewedAt.Format(time.RFC3339)
+	}
+
+	// views of posts deleted in the meantime are dropped by the join
+	query := `
+		INSERT INTO post_views (post_id, viewer_hash, viewed_at)
+		SELECT v.post_id, v.viewer_hash, v.viewed_at
+		FROM unnest($1::bigint[], $2::text[], $3::timestamptz[]) AS v(post_id, viewer_hash, viewed_at)
+		INNER JOIN posts p ON p.id = v.post_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(postIDs), pq.Array(hashes), pq.Array(times))
+	return err
+}
+
+// GetStats returns the stats of a post, with a breakdown for each of the last days days
+func (m ViewModel) GetStats(postID int64, days int) (*PostStats, error) {
+	query := `
+		SELECT
+			(SELECT count(*) FROM post_views WHERE post_id = $1),
+			(SELECT count(DISTINCT viewer_hash) FROM post_views WHERE post_id = $1),
+			(SELECT claps FROM posts WHERE id = $1),
+			(SELECT count(*) FROM comments WHERE post_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var stats PostStats
+
+	err := m.DB.QueryRowContext(ctx, query, postID).Scan(&stats.Views, &stats.UniqueReaders, &stats.Claps, &stats.Comments)
+	if err != nil {
+		return nil, err
+	}
+
+	// generate_series makes sure that days without any activity are included as well
+	query = `
+		SELECT
+			to_char(d.day, 'YYYY-MM-DD'),
+			coalesce(v.views, 0),
+			coalesce(v.readers, 0),
+			coalesce(cl.claps, 0),
+			coalesce(c.comments, 0)
+		FROM generate_series(current_date - ($2::integer - 1), current_date, interval '1 day') AS d(day)
+		LEFT JOIN (
+			SELECT viewed_at::date AS day, count(*) AS views, count(DISTINCT viewer_hash) AS readers
+			FROM post_views
+			WHERE post_id = $1 AND viewed_at >= current_date - ($2::integer - 1)
+			GROUP BY 1
+		) v ON v.day = d.day
+		LEFT JOIN (
+			SELECT created_at::date AS day, sum(delta) AS claps
+			FROM post_clap_events
+			WHERE post_id = $1 AND created_at >= current_date - ($2::integer - 1)
+			GROUP BY 1
+		) cl ON cl.day = d.day
+		LEFT JOIN (
+			SELECT created_at::date AS day, count(*) AS comments
+			FROM comments
+			WHERE post_id = $1 AND created_at >= current_date - ($2::integer - 1)
+			GROUP BY 1
+		) c ON c.day = d.day
+		ORDER BY d.day
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, postID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.Daily = []*DayStats{}
+
+	for rows.Next() {
+		var day DayStats
+
+		err := rows.Scan(&day.Date, &day.Views, &day.UniqueReaders, &day.Claps, &day.Comments)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Daily = append(stats.Daily, &day)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,142 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registering the decoder used by image.Decode
+)
+
+// Spec describes a resized version of an image which is generated after an upload
+type Spec struct {
+	Name   string
+	Width  int
+	Square bool // thumbnails are cropped to a square around the center
+}
+
+// Specs are the variants generated for every uploaded image. Width based variants
+// larger than the original are skipped, and thumbnails of small images keep their
+// size, images are never scaled up.
+var Specs = []Spec{
+	{Name: "thumbnail", Width: 200, Square: true},
+	{Name: "w320", Width: 320},
+	{Name: "w640", Width: 640},
+	{Name: "w1280", Width: 1280},
+}
+
+// Limits on the dimensions of the images which are decoded. A small file can declare huge
+// dimensions, and decoding it would allocate memory for every one of its pixels.
+const (
+	MaxWidth  = 10000
+	MaxHeight = 10000
+	MaxPixels = 40_000_000
+)
+
+var ErrTooLarge = fmt.Errorf("image must not be larger than %dx%d or %d megapixels", MaxWidth, MaxHeight, MaxPixels/1_000_000)
+
+// CheckDimensions reads the dimensions an image declares in its header, without decoding it,
+// and returns ErrTooLarge if they are over the limits
+func CheckDimensions(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return errors.New("image has no pixels")
+	}
+
+	if cfg.Width > MaxWidth || cfg.Height > MaxHeight || cfg.Width*cfg.Height > MaxPixels {
+		return ErrTooLarge
+	}
+
+	return nil
+}
+
+// Decode decodes a JPEG, PNG, GIF or WebP image and returns it along with its format name.
+// Images over the dimension limits aren't decoded, ErrTooLarge is returned instead. JPEG
+// images are rotated according to their EXIF orientation, since that information is lost
+// once the image is re-encoded.
+func Decode(data []byte) (image.Image, string, error) {
+	err := CheckDimensions(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, orientation(data))
+	}
+
+	return img, format, nil
+}
+
+// ReencodeGIF decodes every frame of a GIF and encodes them again. The animation is kept, while the
+// comment and application extensions, which can carry metadata like XMP with a GPS location, are dropped.
+func ReencodeGIF(w io.Writer, data []byte) error {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	return gif.EncodeAll(w, g)
+}
+
+// OutputType returns the content type that images of the given format are re-encoded to.
+// JPEG stays JPEG, everything else becomes PNG to keep the transparency.
+func OutputType(format string) string {
+	if format == "jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Encode writes img in the given content type. The encoders of the standard library don't
+// write any metadata, so re-encoding an image strips its EXIF data, including the GPS location.
+func Encode(w io.Writer, img image.Image, contentType string) error {
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	default:
+		return png.Encode(w, img)
+	}
+}
+
+// Resize scales img to the given width, keeping the aspect ratio
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+
+	height := max(1, b.Dy()*width/b.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
+
+// Thumbnail crops the largest square around the center of img and scales it down to size x size.
+// An image smaller than that is only cropped.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+
+	side := min(b.Dx(), b.Dy())
+	size = min(size, side)
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+side, y+side), draw.Over, nil)
+
+	return dst
+}
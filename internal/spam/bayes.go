@@ -0,0 +1,113 @@
+package spam
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// TokenCount is the number of spam and ham (not spam) training documents a token appeared in
+type TokenCount struct {
+	Spam int
+	Ham  int
+}
+
+// TokenStore keeps what the classifier learned from the moderators' decisions
+type TokenStore interface {
+	// TokenCounts returns the counts of the tokens which appeared in training documents, and the
+	// total number of spam and ham documents trained on
+	TokenCounts(ctx context.Context, tokens []string) (counts map[string]TokenCount, spamDocs, hamDocs int, err error)
+}
+
+// maxTokens caps the tokens taken from a document, so that a long post doesn't make a huge query
+const maxTokens = 300
+
+// Tokenize returns the distinct tokens of a text the classifier learns from: its words of 3 to 30
+// letters or digits, and the domains it links to
+func Tokenize(text string) []string {
+	seen := make(map[string]bool)
+	tokens := []string{}
+
+	add := func(token string) {
+		if !seen[token] && len(tokens) < maxTokens {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, domain := range Domains(text) {
+		add("domain:" + domain)
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(linkRX.ReplaceAllString(text, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		if n := len([]rune(word)); n >= 3 && n <= 30 {
+			add(word)
+		}
+	}
+
+	return tokens
+}
+
+// interestingTokens is how many of the tokens the classification is based on, the ones which lean
+// the most towards spam or ham. The rest only add noise.
+const interestingTokens = 15
+
+// BayesCheck classifies content with a naive Bayes classifier trained on the content moderators
+// approved and rejected. It stays silent until it has seen MinDocuments of both spam and ham.
+type BayesCheck struct {
+	Store        TokenStore
+	MinDocuments int
+}
+
+func (bc BayesCheck) Check(ctx context.Context, c *Content) (*Signal, error) {
+	tokens := Tokenize(c.Text)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	counts, spamDocs, hamDocs, err := bc.Store.TokenCounts(ctx, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if spamDocs < bc.MinDocuments || hamDocs < bc.MinDocuments {
+		return nil, nil
+	}
+
+	// the log likelihood ratio of each known token, with Laplace smoothing
+	ratios := make([]float64, 0, len(counts))
+	for _, count := range counts {
+		pSpam := float64(count.Spam+1) / float64(spamDocs+2)
+		pHam := float64(count.Ham+1) / float64(hamDocs+2)
+		ratios = append(ratios, math.Log(pSpam/pHam))
+	}
+
+	slices.SortFunc(ratios, func(a, b float64) int {
+		return cmp.Compare(math.Abs(b), math.Abs(a))
+	})
+
+	// equal priors, a site with much more ham than spam shouldn't let spam through for that alone
+	logOdds := 0.0
+	for _, ratio := range ratios[:min(len(ratios), interestingTokens)] {
+		logOdds += ratio
+	}
+
+	probability := 1 / (1 + math.Exp(-logOdds))
+	if probability <= 0.5 {
+		return nil, nil
+	}
+
+	return &Signal{
+		Check:  "classifier",
+		Score:  (probability - 0.5) * 2,
+		Reason: fmt.Sprintf("%.0f%% likely to be spam", probability*100),
+	}, nil
+}
@@ -0,0 +1,174 @@
+package spam
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var linkRX = regexp.MustCompile(`(?i)\bhttps?://[^\s<>()"'\]]+|\bwww\.[^\s<>()"'\]]+`)
+
+// Links returns the links in a text, including the bare www. ones
+func Links(text string) []string {
+	return linkRX.FindAllString(text, -1)
+}
+
+// Domains returns the lowercased host names the links in a text point to, without a leading www.
+func Domains(text string) []string {
+	domains := []string{}
+
+	for _, link := range Links(text) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+
+		u, err := url.Parse(link)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		domains = append(domains, strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."))
+	}
+
+	return domains
+}
+
+// LinkCheck flags content with more links than a post or comment usually has
+type LinkCheck struct {
+	MaxLinks int // links allowed without any score
+}
+
+func (lc LinkCheck) Check(ctx context.Context, c *Content) (*Signal, error) {
+	links := len(Links(c.Text))
+	if links <= lc.MaxLinks {
+		return nil, nil
+	}
+
+	// each extra link counts for a quarter, so a handful of them hold the content on their own
+	return &Signal{
+		Check:  "links",
+		Score:  min(0.25*float64(links-lc.MaxLinks), 1),
+		Reason: fmt.Sprintf("%d links, more than the %d allowed", links, lc.MaxLinks),
+	}, nil
+}
+
+// BlocklistCheck flags content containing blocked words, or links to blocked domains. A blocked
+// domain also blocks its subdomains.
+type BlocklistCheck struct {
+	Words   []string // lowercase
+	Domains []string // lowercase, without www.
+}
+
+func (bc BlocklistCheck) Check(ctx context.Context, c *Content) (*Signal, error) {
+	for _, domain := range Domains(c.Text) {
+		for _, blocked := range bc.Domains {
+			if domain == blocked || strings.HasSuffix(domain, "."+blocked) {
+				return &Signal{Check: "blocklist", Score: 1, Reason: "links to the blocked domain " + blocked}, nil
+			}
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(c.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	hits := []string{}
+	for _, blocked := range bc.Words {
+		if slices.Contains(words, blocked) {
+			hits = append(hits, blocked)
+		}
+	}
+
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	return &Signal{
+		Check:  "blocklist",
+		Score:  min(0.5*float64(len(hits)), 1),
+		Reason: "contains the blocked words " + strings.Join(hits, ", "),
+	}, nil
+}
+
+// NewAccountCheck flags content from accounts younger than MinAge, a little on its own and more when
+// it has links, which is what most spam accounts are created for
+type NewAccountCheck struct {
+	MinAge time.Duration
+}
+
+func (nc NewAccountCheck) Check(ctx context.Context, c *Content) (*Signal, error) {
+	age := time.Since(c.AuthorCreatedAt)
+	if age >= nc.MinAge {
+		return nil, nil
+	}
+
+	if len(Links(c.Text)) > 0 {
+		return &Signal{Check: "new_account", Score: 0.6, Reason: "links from an account created " + age.Round(time.Minute).String() + " ago"}, nil
+	}
+
+	return &Signal{Check: "new_account", Score: 0.3, Reason: "account created " + age.Round(time.Minute).String() + " ago"}, nil
+}
+
+// FingerprintStore keeps the fingerprints of recent content
+type FingerprintStore interface {
+	// CountFingerprints returns how many times content with the fingerprint was posted since the given time
+	CountFingerprints(ctx context.Context, fingerprint []byte, since time.Time) (int, error)
+}
+
+// minFingerprintLength is the length under which normalized texts aren't fingerprinted, since short
+// comments like "great post, thanks!" are repeated all the time by real users
+const minFingerprintLength = 40
+
+// Fingerprint returns a hash of a text which ignores case, punctuation and spacing, so that copies
+// with small changes still match. It's nil for texts too short to tell copies apart.
+func Fingerprint(text string) []byte {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	if b.Len() < minFingerprintLength {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return sum[:]
+}
+
+// DuplicateCheck flags content which was already posted MaxCopies times within Window, by anyone
+type DuplicateCheck struct {
+	Store     FingerprintStore
+	Window    time.Duration
+	MaxCopies int
+}
+
+func (dc DuplicateCheck) Check(ctx context.Context, c *Content) (*Signal, error) {
+	fingerprint := Fingerprint(c.Text)
+	if fingerprint == nil {
+		return nil, nil
+	}
+
+	copies, err := dc.Store.CountFingerprints(ctx, fingerprint, time.Now().Add(-dc.Window))
+	if err != nil {
+		return nil, err
+	}
+
+	if copies < dc.MaxCopies {
+		return nil, nil
+	}
+
+	return &Signal{
+		Check:  "duplicate",
+		Score:  1,
+		Reason: fmt.Sprintf("the same text was posted %d times in the last %s", copies, dc.Window),
+	}, nil
+}
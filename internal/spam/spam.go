@@ -0,0 +1,61 @@
+package spam
+
+import (
+	"context"
+	"time"
+)
+
+// Content is a post or a comment about to be published, along with what's known about its author
+type Content struct {
+	Kind            string // post or comment
+	Text            string
+	AuthorID        int64
+	AuthorCreatedAt time.Time
+}
+
+// Signal is something about a piece of content which looks like spam. Scores of around 1 are enough
+// on their own to hold the content for review, smaller ones only add up.
+type Signal struct {
+	Check  string  `json:"check"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// Checker looks at one aspect of content, e.g. its links, and returns nil when nothing looks off
+type Checker interface {
+	Check(ctx context.Context, c *Content) (*Signal, error)
+}
+
+// Verdict is the outcome of running content through a pipeline
+type Verdict struct {
+	Score   float64   `json:"score"`
+	Signals []*Signal `json:"signals"`
+	Held    bool      `json:"held"` // whether the content should be held for review
+}
+
+// Pipeline scores content with each of its checkers, and holds it for review when the sum of their
+// scores reaches the threshold. Content is never rejected outright, since a moderator has the last word.
+type Pipeline struct {
+	Checkers  []Checker
+	Threshold float64
+}
+
+func (p *Pipeline) Evaluate(ctx context.Context, c *Content) (*Verdict, error) {
+	verdict := &Verdict{Signals: []*Signal{}}
+
+	for _, checker := range p.Checkers {
+		signal, err := checker.Check(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		if signal != nil && signal.Score > 0 {
+			verdict.Score += signal.Score
+			verdict.Signals = append(verdict.Signals, signal)
+		}
+	}
+
+	verdict.Held = len(p.Checkers) > 0 && verdict.Score >= p.Threshold
+
+	return verdict, nil
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage is a place where uploaded files are kept, e.g. the local filesystem or an S3 bucket.
+// Keys are slash separated paths like "12/ABCDEF.png".
+type Storage interface {
+	// Put stores size bytes from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get returns the contents stored under key, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object stored under key, it is not an error if it doesn't exist
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL of the object stored under key
+	URL(key string) string
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS series (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_series_user_id ON series (user_id);
+
+-- A post can only belong to one series, which keeps the previous/next links unambiguous.
+-- The position constraint is deferred so that a reorder can swap positions inside a single transaction.
+CREATE TABLE IF NOT EXISTS series_posts (
+    series_id BIGINT NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (series_id, post_id),
+    CONSTRAINT series_posts_position_key UNIQUE (series_id, position) DEFERRABLE INITIALLY DEFERRED
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS post_collaborators (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('co-author', 'reviewer')),
+    invited_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    accepted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_collaborators_user_id ON post_collaborators (user_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS post_reviews;
+
+DROP TABLE IF EXISTS users_permissions;
+
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+-- posts:review lets a user review any post that was submitted for review
+-- posts:publish marks a user as an editor, who publishes approved posts when review mode is enabled
+INSERT INTO permissions (code)
+VALUES ('posts:review'), ('posts:publish')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS post_reviews (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reviewer_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    decision TEXT NOT NULL CHECK (decision IN ('approve', 'reject')),
+    comment TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reviews_post_id ON post_reviews (post_id);
@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS word_count,
+DROP COLUMN IF EXISTS reading_time,
+DROP COLUMN IF EXISTS excerpt;
@@ -0,0 +1,24 @@
+ALTER TABLE posts
+ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN reading_time INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN excerpt TEXT NOT NULL DEFAULT '';
+
+-- Backfilling the old rows with an approximation, since markdown can't be properly stripped in SQL.
+-- The application computes the exact values the next time a post is updated.
+UPDATE posts SET
+    word_count = coalesce(array_length(regexp_split_to_array(trim(content), '\s+'), 1), 0);
+
+-- The excerpt is cut at a word boundary like the application does: the words fitting in 199
+-- characters followed by an ellipsis, or the first 199 characters of a longer first word.
+WITH plain AS (
+    SELECT id, trim(regexp_replace(regexp_replace(content, '[#*_`>\[\]]', '', 'g'), '\s+', ' ', 'g')) AS text
+    FROM posts
+)
+UPDATE posts SET excerpt = CASE
+    WHEN char_length(plain.text) <= 200 THEN plain.text
+    ELSE coalesce(nullif(substring(left(plain.text, 200) from '^(.*) '), ''), left(plain.text, 199)) || '…'
+END
+FROM plain
+WHERE posts.id = plain.id;
+
+UPDATE posts SET reading_time = GREATEST(1, CEIL(word_count / 238.0));
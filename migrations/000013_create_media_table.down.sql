@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS cover_image_id;
+
+DROP TABLE IF EXISTS media;
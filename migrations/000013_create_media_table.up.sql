@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    storage_key TEXT NOT NULL UNIQUE,
+    filename TEXT NOT NULL DEFAULT '',
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+ALTER TABLE posts
+ADD COLUMN cover_image_id BIGINT REFERENCES media(id) ON DELETE SET NULL;
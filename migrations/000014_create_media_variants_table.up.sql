@@ -0,0 +1,20 @@
+-- status is one of pending, ready or failed. Uploads made before the image pipeline existed
+-- are left pending, so that they get processed the next time the server starts.
+ALTER TABLE media
+ADD COLUMN width INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN height INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_media_status ON media (status) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS media_variants (
+    id bigserial PRIMARY KEY,
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    UNIQUE (media_id, name)
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS post_claps_update_total ON post_claps;
+
+DROP FUNCTION IF EXISTS post_claps_update_total();
+
+DROP TABLE IF EXISTS post_claps;
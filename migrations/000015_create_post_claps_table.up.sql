@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS post_claps (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    count INTEGER NOT NULL CHECK (count > 0),
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_claps_user_id ON post_claps (user_id);
+
+-- posts.claps is kept as a denormalized total of post_claps by a trigger, so that it also stays
+-- consistent when rows are removed by a cascade, e.g. when a user deletes their account.
+-- Claps made before this table existed weren't attributed to anyone, so they stay in the total.
+CREATE FUNCTION post_claps_update_total() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE posts SET claps = claps + NEW.count WHERE id = NEW.post_id;
+  ELSIF TG_OP = 'UPDATE' THEN
+    UPDATE posts SET claps = claps + NEW.count - OLD.count WHERE id = NEW.post_id;
+  ELSIF TG_OP = 'DELETE' THEN
+    UPDATE posts SET claps = GREATEST(claps - OLD.count, 0) WHERE id = OLD.post_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_claps_update_total
+AFTER INSERT OR UPDATE OR DELETE ON post_claps
+FOR EACH ROW EXECUTE FUNCTION post_claps_update_total();
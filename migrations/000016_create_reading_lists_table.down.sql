@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reading_list_posts;
+
+DROP TABLE IF EXISTS reading_lists;
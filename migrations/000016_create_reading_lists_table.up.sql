@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS reading_lists (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- list names are unique per user regardless of their case, and every user has at most one default list
+CREATE UNIQUE INDEX IF NOT EXISTS reading_lists_user_id_name_key ON reading_lists (user_id, lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS reading_lists_user_id_default_key ON reading_lists (user_id) WHERE is_default;
+
+CREATE TABLE IF NOT EXISTS reading_list_posts (
+    reading_list_id BIGINT NOT NULL REFERENCES reading_lists(id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    added_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (reading_list_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_list_posts_post_id ON reading_list_posts (post_id);
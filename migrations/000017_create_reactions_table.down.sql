@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS comments_delete_reactions ON comments;
+
+DROP TRIGGER IF EXISTS posts_delete_reactions ON posts;
+
+DROP FUNCTION IF EXISTS reactions_delete_for_target();
+
+DROP TABLE IF EXISTS reactions;
@@ -0,0 +1,27 @@
+-- Reactions can target posts or comments. Since the target is polymorphic it can't have a foreign key,
+-- so the reactions of deleted posts and comments are removed by the triggers below.
+CREATE TABLE IF NOT EXISTS reactions (
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (target_type, target_id, user_id, emoji)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_user_id ON reactions (user_id);
+
+CREATE FUNCTION reactions_delete_for_target() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM reactions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_delete_reactions
+AFTER DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION reactions_delete_for_target('post');
+
+CREATE TRIGGER comments_delete_reactions
+AFTER DELETE ON comments
+FOR EACH ROW EXECUTE FUNCTION reactions_delete_for_target('comment');
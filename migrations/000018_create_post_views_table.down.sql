@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS post_claps_log_event ON post_claps;
+
+DROP FUNCTION IF EXISTS post_claps_log_event();
+
+DROP TABLE IF EXISTS post_clap_events;
+
+DROP TABLE IF EXISTS post_views;
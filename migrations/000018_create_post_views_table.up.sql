@@ -0,0 +1,38 @@
+-- viewer_hash identifies a reader (a user, or the IP address of an anonymous one) without storing
+-- who they are, it's only used to count unique readers
+CREATE TABLE IF NOT EXISTS post_views (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    viewer_hash TEXT NOT NULL,
+    viewed_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_views_post_id_viewed_at ON post_views (post_id, viewed_at);
+
+-- post_claps only keeps the current number of claps of each user, so the changes are logged here
+-- to be able to tell when the claps of a post came in
+CREATE TABLE IF NOT EXISTS post_clap_events (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    delta INTEGER NOT NULL,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_clap_events_post_id_created_at ON post_clap_events (post_id, created_at);
+
+CREATE FUNCTION post_claps_log_event() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO post_clap_events (post_id, delta) VALUES (NEW.post_id, NEW.count);
+  ELSIF TG_OP = 'UPDATE' AND NEW.count <> OLD.count THEN
+    INSERT INTO post_clap_events (post_id, delta) VALUES (NEW.post_id, NEW.count - OLD.count);
+  ELSIF TG_OP = 'DELETE' THEN
+    -- the post itself may be getting deleted, in which case there is nothing to log
+    INSERT INTO post_clap_events (post_id, delta)
+    SELECT id, -OLD.count FROM posts WHERE id = OLD.post_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_claps_log_event
+AFTER INSERT OR UPDATE OR DELETE ON post_claps
+FOR EACH ROW EXECUTE FUNCTION post_claps_log_event();
@@ -0,0 +1,9 @@
+-- Trending scores of published posts, recomputed periodically by a background job.
+-- Posts without any recent activity have no row.
+CREATE TABLE IF NOT EXISTS post_scores (
+    post_id BIGINT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_scores_score ON post_scores (score DESC);
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'tags:manage';
+
+DROP INDEX IF EXISTS posts_tags_idx;
+
+DROP TABLE IF EXISTS tag_aliases;
+
+DROP TABLE IF EXISTS tags;
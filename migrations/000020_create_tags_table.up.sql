@@ -0,0 +1,71 @@
+-- Tags are identified by their canonical slug, which is what posts.tags contains
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+-- Alternative spellings of a tag, e.g. golang for go. Aliases are replaced by the slug of their tag
+-- when a post is saved.
+CREATE TABLE IF NOT EXISTS tag_aliases (
+    alias TEXT PRIMARY KEY,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_aliases_tag_id ON tag_aliases (tag_id);
+
+CREATE INDEX IF NOT EXISTS posts_tags_idx ON posts USING GIN (tags);
+
+-- tags:manage lets a user edit tag descriptions and merge tags into aliases
+INSERT INTO permissions (code)
+VALUES ('tags:manage')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tags (slug, name)
+VALUES ('go', 'Go'), ('javascript', 'JavaScript'), ('typescript', 'TypeScript'), ('kubernetes', 'Kubernetes'), ('postgresql', 'PostgreSQL')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tag_aliases (alias, tag_id)
+SELECT a.alias, t.id
+FROM (VALUES ('golang', 'go'), ('js', 'javascript'), ('ts', 'typescript'), ('k8s', 'kubernetes'), ('postgres', 'postgresql')) AS a(alias, slug)
+INNER JOIN tags t ON t.slug = a.slug
+ON CONFLICT DO NOTHING;
+
+-- Normalizing the existing tags the same way data.NormalizeTag does: lower case, runs of whitespace,
+-- underscores and hyphens turned into a single hyphen, and anything else that isn't a letter, a digit,
+-- or one of +#. dropped. Aliases are then replaced by their tag, keeping the first occurrence of duplicates.
+CREATE FUNCTION normalize_tag(tag TEXT) RETURNS TEXT AS $$
+  SELECT trim(BOTH '-' FROM regexp_replace(
+    regexp_replace(lower(trim(tag)), '[[:space:]_-]+', '-', 'g'),
+    '[^[:alnum:]+#.-]', '', 'g'
+  ));
+$$ LANGUAGE sql IMMUTABLE;
+
+UPDATE posts p
+SET tags = coalesce(nullif(normalized.tags, '{}'), ARRAY['uncategorized'])
+FROM (
+    SELECT p.id, ARRAY(
+        SELECT slug
+        FROM (
+            SELECT coalesce(t.slug, normalize_tag(u.tag)) AS slug, u.n
+            FROM unnest(p.tags) WITH ORDINALITY AS u(tag, n)
+            LEFT JOIN tag_aliases a ON a.alias = normalize_tag(u.tag)
+            LEFT JOIN tags t ON t.id = a.tag_id
+        ) s
+        WHERE slug <> ''
+        GROUP BY slug
+        ORDER BY min(n)
+        LIMIT 5
+    ) AS tags
+    FROM posts p
+) normalized
+WHERE normalized.id = p.id AND normalized.tags IS DISTINCT FROM p.tags;
+
+INSERT INTO tags (slug, name)
+SELECT DISTINCT tag, tag
+FROM posts, unnest(tags) AS tag
+ON CONFLICT DO NOTHING;
+
+DROP FUNCTION normalize_tag(TEXT);
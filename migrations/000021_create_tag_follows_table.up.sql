@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS tag_follows (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_follows_tag_id ON tag_follows (tag_id);
+
+-- Users who follow tags get a digest email, unless they unsubscribed. A user without a row
+-- has never received a digest.
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    unsubscribed_at TIMESTAMPTZ(0),
+    last_sent_at TIMESTAMPTZ(0)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS users_username_trgm_idx;
+
+DROP INDEX IF EXISTS tags_slug_trgm_idx;
+
+DROP INDEX IF EXISTS posts_title_trgm_idx;
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,8 @@
+-- Trigram matching finds titles, tags and usernames despite typos, e.g. kubernets for kubernetes
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS posts_title_trgm_idx ON posts USING GIN (title gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS tags_slug_trgm_idx ON tags USING GIN (slug gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN (username gin_trgm_ops);
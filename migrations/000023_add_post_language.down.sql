@@ -0,0 +1,19 @@
+CREATE OR REPLACE FUNCTION posts_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(NEW.subtitle, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(NEW.content, '')), 'C');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS post_search_config(TEXT);
+
+ALTER TABLE posts DROP COLUMN IF EXISTS language;
+
+-- Rebuilding the search vectors with english
+UPDATE posts SET search_vector =
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(subtitle, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'C');
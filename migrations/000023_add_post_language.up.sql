@@ -0,0 +1,60 @@
+-- The language of a post decides how its search vector is stemmed, as an ISO 639-1 code
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT 'en';
+
+-- Maps the language of a post to its text search configuration, the same way data.searchConfigs does
+CREATE OR REPLACE FUNCTION post_search_config(language TEXT) RETURNS regconfig AS $$
+  SELECT CASE language
+    WHEN 'de' THEN 'german'
+    WHEN 'es' THEN 'spanish'
+    WHEN 'fr' THEN 'french'
+    WHEN 'it' THEN 'italian'
+    WHEN 'nl' THEN 'dutch'
+    WHEN 'pt' THEN 'portuguese'
+    ELSE 'english'
+  END::regconfig
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION posts_search_vector_update() RETURNS trigger AS $$
+DECLARE
+  config regconfig := post_search_config(NEW.language);
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector(config, coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector(config, coalesce(NEW.subtitle, '')), 'B') ||
+    setweight(to_tsvector(config, coalesce(NEW.content, '')), 'C');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Detects the language of the existing posts like data.DetectLanguage does, from the common words
+-- of each language, falling back to english when there are fewer than 3 of them or it's a tie.
+-- It's only needed for the backfill.
+CREATE FUNCTION detect_post_language(body TEXT) RETURNS TEXT AS $$
+  WITH stopwords(language, words) AS (
+    VALUES
+      ('de', ARRAY['der', 'und', 'nicht', 'ist', 'ich', 'mit', 'sich', 'auf', 'für', 'auch', 'wir', 'eine', 'wird', 'zu', 'dem']),
+      ('en', ARRAY['the', 'and', 'of', 'to', 'with', 'that', 'this', 'for', 'are', 'was', 'it', 'you', 'not', 'be', 'is']),
+      ('es', ARRAY['el', 'los', 'las', 'y', 'es', 'por', 'pero', 'más', 'está', 'del', 'muy', 'también', 'cuando', 'hay', 'sus']),
+      ('fr', ARRAY['les', 'et', 'est', 'une', 'pour', 'pas', 'dans', 'qui', 'sur', 'avec', 'ce', 'sont', 'au', 'des', 'nous']),
+      ('it', ARRAY['gli', 'è', 'per', 'non', 'che', 'sono', 'della', 'nel', 'alla', 'questo', 'anche', 'di', 'dei', 'degli', 'molto']),
+      ('nl', ARRAY['het', 'een', 'niet', 'van', 'dat', 'zijn', 'voor', 'met', 'ook', 'wordt', 'maar', 'bij', 'naar', 'hij', 'wij']),
+      ('pt', ARRAY['uma', 'não', 'com', 'são', 'mais', 'pelo', 'pela', 'ao', 'muito', 'também', 'isso', 'você', 'seu', 'foi', 'ele'])
+  ),
+  hits AS (
+    SELECT s.language, count(*) AS n
+    FROM regexp_split_to_table(lower(body), '[^[:alpha:]]+') AS w
+    INNER JOIN stopwords s ON w = ANY(s.words)
+    GROUP BY s.language
+  )
+  SELECT CASE
+    WHEN (SELECT count(*) FROM hits WHERE n = (SELECT max(n) FROM hits)) = 1
+      AND (SELECT max(n) FROM hits) >= 3
+    THEN (SELECT language FROM hits ORDER BY n DESC LIMIT 1)
+    ELSE 'en'
+  END
+$$ LANGUAGE sql;
+
+-- Backfilling the language, the trigger rebuilds the search vectors with it
+UPDATE posts SET language = detect_post_language(concat_ws(' ', title, subtitle, content));
+
+DROP FUNCTION detect_post_language(TEXT);
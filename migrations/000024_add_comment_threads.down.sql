@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS comments_set_path ON comments;
+
+DROP FUNCTION IF EXISTS comments_set_path();
+
+-- the replies would turn into top level comments, and the deleted comments into empty ones
+DELETE FROM comments WHERE parent_id IS NOT NULL OR deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS comments_post_id_path_idx;
+
+DROP INDEX IF EXISTS comments_parent_id_idx;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS depth,
+    DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,33 @@
+-- Comments can reply to another comment of the same post. path holds the ids of the ancestors of a
+-- comment followed by its own, so that ordering by it lists the replies of each comment right after it.
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS path BIGINT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ(0); -- set on deleted comments kept for their replies
+
+UPDATE comments SET path = ARRAY[id];
+
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
+
+CREATE INDEX IF NOT EXISTS comments_post_id_path_idx ON comments (post_id, path);
+
+CREATE OR REPLACE FUNCTION comments_set_path() RETURNS trigger AS $$
+DECLARE
+  parent comments%ROWTYPE;
+BEGIN
+  IF NEW.parent_id IS NULL THEN
+    NEW.depth := 0;
+    NEW.path := ARRAY[NEW.id];
+  ELSE
+    SELECT * INTO parent FROM comments WHERE id = NEW.parent_id;
+    NEW.depth := parent.depth + 1;
+    NEW.path := parent.path || NEW.id;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_set_path
+BEFORE INSERT ON comments
+FOR EACH ROW EXECUTE FUNCTION comments_set_path();
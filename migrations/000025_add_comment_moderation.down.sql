@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS moderation_actions;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS hidden_at;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS comments_mode;
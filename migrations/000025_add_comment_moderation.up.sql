@@ -0,0 +1,24 @@
+-- open: anyone can comment, locked: the comments stay but no new ones can be added,
+-- disabled: the comments are only visible to the author of the post and no new ones can be added
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS comments_mode TEXT NOT NULL DEFAULT 'open'
+        CHECK (comments_mode IN ('open', 'locked', 'disabled'));
+
+-- hidden comments are only visible to the author of the post and the author of the comment
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ(0);
+
+-- comment_id isn't a foreign key, so that deletions are still logged once the comment is gone
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    moderator_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id BIGINT,
+    action TEXT NOT NULL CHECK (action IN (
+        'hide_comment', 'unhide_comment', 'delete_comment', 'open_comments', 'lock_comments', 'disable_comments'
+    )),
+    reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_post_id ON moderation_actions (post_id);
@@ -0,0 +1,22 @@
+DELETE FROM moderation_actions
+WHERE action IN ('hide_post', 'delete_post', 'suspend_user')
+    OR post_id IS NULL
+    OR NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = moderation_actions.post_id);
+
+ALTER TABLE moderation_actions
+    DROP CONSTRAINT IF EXISTS moderation_actions_action_check,
+    ADD CONSTRAINT moderation_actions_action_check CHECK (action IN (
+        'hide_comment', 'unhide_comment', 'delete_comment', 'open_comments', 'lock_comments', 'disable_comments'
+    )),
+    DROP CONSTRAINT IF EXISTS moderation_actions_post_id_fkey,
+    ADD CONSTRAINT moderation_actions_post_id_fkey FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    ALTER COLUMN post_id SET NOT NULL,
+    DROP COLUMN IF EXISTS report_id,
+    DROP COLUMN IF EXISTS user_id;
+
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_at;
+
+DELETE FROM permissions WHERE code = 'reports:moderate';
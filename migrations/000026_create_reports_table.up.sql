@@ -0,0 +1,47 @@
+-- reports:moderate lets a user work through the report queue and act on the reported content
+INSERT INTO permissions (code)
+VALUES ('reports:moderate')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ(0);
+
+-- target_id isn't a foreign key since it points to a post, a comment or a user depending on target_type,
+-- and reports outlive the content they're about once it's deleted
+CREATE TABLE IF NOT EXISTS reports (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    reporter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id BIGINT NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN (
+        'spam', 'harassment', 'hate_speech', 'violence', 'sexual_content', 'misinformation', 'other'
+    )),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    resolved_at TIMESTAMPTZ(0),
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolution TEXT NOT NULL DEFAULT '', -- the action taken, e.g. hide
+    note TEXT NOT NULL DEFAULT ''
+);
+
+-- a user can only have one open report on the same content
+CREATE UNIQUE INDEX IF NOT EXISTS reports_open_unique_idx ON reports (reporter_id, target_type, target_id) WHERE status = 'open';
+
+CREATE INDEX IF NOT EXISTS idx_reports_status_created_at ON reports (status, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_reports_target ON reports (target_type, target_id);
+
+-- actions taken on reports are logged with the rest of the moderation actions. They can be about a user
+-- rather than a post, and like comment_id, post_id is no longer a foreign key so that the deletion of a
+-- post can be logged and kept in the log.
+ALTER TABLE moderation_actions
+    ALTER COLUMN post_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS report_id BIGINT REFERENCES reports(id) ON DELETE SET NULL,
+    DROP CONSTRAINT IF EXISTS moderation_actions_post_id_fkey,
+    DROP CONSTRAINT IF EXISTS moderation_actions_action_check,
+    ADD CONSTRAINT moderation_actions_action_check CHECK (action IN (
+        'hide_comment', 'unhide_comment', 'delete_comment', 'open_comments', 'lock_comments', 'disable_comments',
+        'hide_post', 'delete_post', 'suspend_user'
+    ));
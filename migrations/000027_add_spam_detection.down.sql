@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS spam_documents;
+
+DROP TABLE IF EXISTS spam_tokens;
+
+DROP TABLE IF EXISTS content_fingerprints;
+
+DROP TABLE IF EXISTS spam_holds;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS held_at;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS held_at;
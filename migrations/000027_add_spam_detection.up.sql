@@ -0,0 +1,54 @@
+-- content held for review is only visible to its author until a moderator approves it
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS held_at TIMESTAMPTZ(0);
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS held_at TIMESTAMPTZ(0);
+
+-- the review queue of held content. content is a copy of the text, which the classifier is trained
+-- on once a moderator decides on it.
+CREATE TABLE IF NOT EXISTS spam_holds (
+    id bigserial PRIMARY KEY,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id BIGINT NOT NULL,
+    author_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    signals JSONB NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'approved', 'rejected')),
+    reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ(0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS spam_holds_target_idx ON spam_holds (target_type, target_id);
+
+CREATE INDEX IF NOT EXISTS idx_spam_holds_status_created_at ON spam_holds (status, created_at, id);
+
+-- fingerprints of recent posts and comments, to catch the same text posted over and over
+CREATE TABLE IF NOT EXISTS content_fingerprints (
+    fingerprint BYTEA NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_fingerprints_fingerprint ON content_fingerprints (fingerprint, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_content_fingerprints_created_at ON content_fingerprints (created_at);
+
+-- what the spam classifier learned: the number of spam and ham documents each token appeared in,
+-- and the number of documents of each class
+CREATE TABLE IF NOT EXISTS spam_tokens (
+    token TEXT PRIMARY KEY,
+    spam_count INTEGER NOT NULL DEFAULT 0,
+    ham_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS spam_documents (
+    class TEXT PRIMARY KEY CHECK (class IN ('spam', 'ham')),
+    count INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO spam_documents (class)
+VALUES ('spam'), ('ham')
+ON CONFLICT DO NOTHING;
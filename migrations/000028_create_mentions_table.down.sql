@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS comments_delete_mentions ON comments;
+DROP TRIGGER IF EXISTS posts_delete_mentions ON posts;
+DROP FUNCTION IF EXISTS mentions_delete_for_target();
+
+DROP TABLE IF EXISTS mentions;
+
+DROP TABLE IF EXISTS user_blocks;
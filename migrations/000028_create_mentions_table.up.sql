@@ -0,0 +1,38 @@
+-- Users can block other users, whose mentions of them are then ignored
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+-- Mentions of users in posts and comments. Like reactions, the target is polymorphic, so the mentions
+-- of deleted posts and comments are removed by the triggers below.
+CREATE TABLE IF NOT EXISTS mentions (
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    author_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (target_type, target_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id, author_id);
+
+CREATE FUNCTION mentions_delete_for_target() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM mentions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_delete_mentions
+AFTER DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION mentions_delete_for_target('post');
+
+CREATE TRIGGER comments_delete_mentions
+AFTER DELETE ON comments
+FOR EACH ROW EXECUTE FUNCTION mentions_delete_for_target('comment');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_post_scores_score;
+
+CREATE INDEX IF NOT EXISTS idx_post_scores_score ON post_scores (score DESC);
@@ -0,0 +1,4 @@
+-- The trending list is ordered by (score, post_id), which this index can be walked in, one page at a time
+DROP INDEX IF EXISTS idx_post_scores_score;
+
+CREATE INDEX IF NOT EXISTS idx_post_scores_score ON post_scores (score DESC, post_id DESC);
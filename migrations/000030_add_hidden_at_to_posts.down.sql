@@ -0,0 +1,3 @@
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_hidden_not_published_check,
+    DROP COLUMN IF EXISTS hidden_at;
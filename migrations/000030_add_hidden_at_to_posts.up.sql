@@ -0,0 +1,11 @@
+-- A post hidden by a moderator goes back to draft and can't be published again by its author. Posts
+-- hidden before the column existed are found in the moderation log.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ(0);
+
+UPDATE posts p SET hidden_at = a.created_at
+FROM moderation_actions a
+WHERE a.post_id = p.id AND a.action = 'hide_post' AND p.status <> 'published';
+
+ALTER TABLE posts
+    ADD CONSTRAINT posts_hidden_not_published_check CHECK (hidden_at IS NULL OR status <> 'published');
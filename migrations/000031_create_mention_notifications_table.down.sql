@@ -0,0 +1,8 @@
+CREATE OR REPLACE FUNCTION mentions_delete_for_target() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM mentions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS mention_notifications;
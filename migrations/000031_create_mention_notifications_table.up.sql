@@ -0,0 +1,27 @@
+-- The users who were emailed about a mention in a post or comment. Unlike the mentions, which follow
+-- the edits of the content, the notifications are kept, so that removing a mention and adding it back
+-- doesn't email the user again. Mentions in content held as spam are only notified once it's approved.
+CREATE TABLE IF NOT EXISTS mention_notifications (
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notified_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (target_type, target_id, user_id)
+);
+
+-- the existing mentions of content which isn't held were notified when they were added
+INSERT INTO mention_notifications (target_type, target_id, user_id, notified_at)
+SELECT m.target_type, m.target_id, m.user_id, m.created_at
+FROM mentions m
+WHERE m.user_id <> m.author_id
+    AND NOT EXISTS (SELECT 1 FROM posts p WHERE m.target_type = 'post' AND p.id = m.target_id AND p.held_at IS NOT NULL)
+    AND NOT EXISTS (SELECT 1 FROM comments c WHERE m.target_type = 'comment' AND c.id = m.target_id AND c.held_at IS NOT NULL)
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION mentions_delete_for_target() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM mentions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+  DELETE FROM mention_notifications WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
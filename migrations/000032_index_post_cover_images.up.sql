@@ -0,0 +1,3 @@
+-- Finds the posts an image is the cover of, when it's fetched by someone other than its uploader
+-- and when it's deleted
+CREATE INDEX IF NOT EXISTS idx_posts_cover_image_id ON posts (cover_image_id) WHERE cover_image_id IS NOT NULL;
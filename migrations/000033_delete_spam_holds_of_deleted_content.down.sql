@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS comments_delete_spam_holds ON comments;
+DROP TRIGGER IF EXISTS posts_delete_spam_holds ON posts;
+DROP FUNCTION IF EXISTS spam_holds_delete_for_target();
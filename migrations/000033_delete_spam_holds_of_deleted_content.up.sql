@@ -0,0 +1,22 @@
+-- Deleting held content takes it out of the review queue. Like the reactions, the holds point to a post
+-- or a comment depending on target_type, so they're removed by triggers. Reviewed holds are kept as the
+-- record of the decision.
+DELETE FROM spam_holds h
+WHERE h.status = 'held'
+    AND NOT EXISTS (SELECT 1 FROM posts p WHERE h.target_type = 'post' AND p.id = h.target_id)
+    AND NOT EXISTS (SELECT 1 FROM comments c WHERE h.target_type = 'comment' AND c.id = h.target_id AND c.deleted_at IS NULL);
+
+CREATE FUNCTION spam_holds_delete_for_target() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM spam_holds WHERE target_type = TG_ARGV[0] AND target_id = OLD.id AND status = 'held';
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_delete_spam_holds
+AFTER DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION spam_holds_delete_for_target('post');
+
+CREATE TRIGGER comments_delete_spam_holds
+AFTER DELETE ON comments
+FOR EACH ROW EXECUTE FUNCTION spam_holds_delete_for_target('comment');
@@ -0,0 +1,2 @@
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_held_not_published_check;
@@ -0,0 +1,4 @@
+-- Edits are held for review like new posts, and a post held as spam goes back to draft until it's
+-- approved, so that none of the lists of published posts show it
+ALTER TABLE posts
+    ADD CONSTRAINT posts_held_not_published_check CHECK (held_at IS NULL OR status <> 'published');